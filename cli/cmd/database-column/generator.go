@@ -1,155 +1,520 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+
+	"gorm.io/gorm/schema"
 )
 
-func generateColumnFiles(modelPath string) error {
-	// 获取所有 Go 文件
-	files, err := os.ReadDir(modelPath)
-	if err != nil {
+const generatedSuffix = "_cols.gen.go"
+
+// naming 与 gorm 默认的命名策略一致，用于推导没有 column 标签的字段的列名
+var naming = schema.NamingStrategy{}
+
+type generator struct {
+	// recursive 为 true 时遍历所有子目录
+	recursive bool
+	// output 不为空时每个包的模型生成到同一个文件，否则生成到模型所在文件旁的 _cols.gen.go
+	output string
+}
+
+type column struct {
+	Field  string
+	Column string
+	Type   string
+	// Value 为条件与更新方法的参数类型，指针字段为其元素类型
+	Value    string
+	Ordered  bool
+	Text     bool
+	Nullable bool
+	// Serialized 为 true 时列的值由序列化器编码，与字段值的比较没有意义，不生成条件方法
+	Serialized bool
+}
+
+type model struct {
+	Name    string
+	Columns []column
+	file    string
+	imports map[string]string
+}
+
+// sourcePackage 是一个目录下的包，类型声明可能分布在多个文件中
+type sourcePackage struct {
+	name    string
+	files   map[string]*ast.File
+	structs map[string]*ast.StructType
+	// typeFiles 记录类型声明所在的文件，用于解析字段类型引用的包
+	typeFiles map[string]string
+	models    map[string]bool
+}
+
+func generateColumnFiles(modelPath string, g generator) error {
+	if !g.recursive {
+		return g.processDir(modelPath)
+	}
+
+	return filepath.WalkDir(modelPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+
+		name := entry.Name()
+		if path != modelPath && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+			return filepath.SkipDir
+		}
+
+		return g.processDir(path)
+	})
+}
+
+func (g generator) processDir(dir string) error {
+	pkg, err := g.parsePackage(dir)
+	if err != nil || pkg == nil {
 		return err
 	}
 
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".go" {
-			err := processFile(filepath.Join(modelPath, file.Name()))
-			if err != nil {
-				return err
-			}
+	var models []*model
+	for name := range pkg.models {
+		structType, exist := pkg.structs[name]
+		if !exist {
+			continue
+		}
+
+		m := &model{Name: name, file: pkg.typeFiles[name], imports: map[string]string{}}
+		pkg.resolveFields(m, structType, pkg.typeFiles[name], "", "", map[string]bool{name: true})
+		if len(m.Columns) > 0 {
+			models = append(models, m)
+		}
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].file != models[j].file {
+			return models[i].file < models[j].file
+		}
+		return models[i].Name < models[j].Name
+	})
+
+	if g.output != "" {
+		if len(models) == 0 {
+			return nil
+		}
+		return writeColumnFile(filepath.Join(dir, g.output), pkg.name, models)
+	}
+
+	byFile := map[string][]*model{}
+	for _, m := range models {
+		byFile[m.file] = append(byFile[m.file], m)
+	}
+	for file, fileModels := range byFile {
+		if err = writeColumnFile(strings.TrimSuffix(file, ".go")+generatedSuffix, pkg.name, fileModels); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func processFile(filename string) error {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+func (g generator) parsePackage(dir string) (*sourcePackage, error) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, f := range node.Decls {
-		if gen, ok := f.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
-			for _, spec := range gen.Specs {
-				if ts, ok := spec.(*ast.TypeSpec); ok {
-					if structType, ok := ts.Type.(*ast.StructType); ok {
-						if hasTableNameMethod(node, ts.Name.Name) {
-							err := generateColumnFile(filename, ts.Name.Name, structType)
-							if err != nil {
-								return err
-							}
-						}
-					}
-				}
-			}
+	pkg := &sourcePackage{
+		files:     map[string]*ast.File{},
+		structs:   map[string]*ast.StructType{},
+		typeFiles: map[string]string{},
+		models:    map[string]bool{},
+	}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") ||
+			strings.HasSuffix(name, generatedSuffix) || (g.output != "" && name == g.output) {
+			continue
 		}
+
+		filename := filepath.Join(dir, name)
+		node, parseErr := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		pkg.name = node.Name.Name
+		pkg.files[filename] = node
+		pkg.collect(filename, node)
 	}
 
-	return nil
+	if len(pkg.files) == 0 {
+		return nil, nil
+	}
+
+	return pkg, nil
 }
 
-func hasTableNameMethod(node *ast.File, structName string) bool {
+func (p *sourcePackage) collect(filename string, node *ast.File) {
 	for _, decl := range node.Decls {
-		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
-			if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
-				recvType := funcDecl.Recv.List[0].Type
-				// Check if the receiver is a pointer to the struct
-				if starExpr, ok := recvType.(*ast.StarExpr); ok {
-					if ident, ok := starExpr.X.(*ast.Ident); ok && ident.Name == structName {
-						if funcDecl.Name.Name == "TableName" {
-							return true
-						}
-					}
-				}
-
-				// Check if the receiver is the struct itself (non-pointer receiver)
-				if ident, ok := recvType.(*ast.Ident); ok && ident.Name == structName {
-					if funcDecl.Name.Name == "TableName" {
-						return true
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					if structType, ok := ts.Type.(*ast.StructType); ok {
+						p.structs[ts.Name.Name] = structType
+						p.typeFiles[ts.Name.Name] = filename
 					}
 				}
 			}
+		case *ast.FuncDecl:
+			// 接收者为结构体或其指针，且有 TableName 方法的结构体视为模型
+			if d.Recv == nil || len(d.Recv.List) == 0 || d.Name.Name != "TableName" {
+				continue
+			}
+			recvType := d.Recv.List[0].Type
+			if star, ok := recvType.(*ast.StarExpr); ok {
+				recvType = star.X
+			}
+			if ident, ok := recvType.(*ast.Ident); ok {
+				p.models[ident.Name] = true
+			}
 		}
 	}
-	return false
 }
 
-func generateColumnFile(filename, structName string, structType *ast.StructType) error {
-	var columns []string
+// resolveFields 按照 gorm 的解析规则收集结构体的列，嵌入的结构体与 embedded 标签的字段会被展开，
+// fieldPrefix 为展开具名嵌入字段时的字段名前缀，columnPrefix 为 embeddedPrefix 指定的列名前缀
+func (p *sourcePackage) resolveFields(m *model, structType *ast.StructType, filename, fieldPrefix, columnPrefix string, visiting map[string]bool) {
 	for _, field := range structType.Fields.List {
+		settings := map[string]string{}
 		if field.Tag != nil {
-			tag := field.Tag.Value
-			columnName := getColumnFromTag(tag)
-			if columnName != "" {
-				columns = append(columns, fmt.Sprintf("%s string", field.Names[0].Name))
+			tag, _ := strconv.Unquote(field.Tag.Value)
+			settings = schema.ParseTagSetting(reflect.StructTag(tag).Get("gorm"), ";")
+		}
+		if ignore, exist := settings["-"]; exist && strings.ToLower(strings.TrimSpace(ignore)) != "migration" {
+			continue
+		}
+
+		prefix := columnPrefix + settings["EMBEDDEDPREFIX"]
+		if len(field.Names) == 0 {
+			p.resolveEmbedded(m, field.Type, filename, fieldPrefix, prefix, visiting)
+			continue
+		}
+
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+
+			if _, embedded := settings["EMBEDDED"]; embedded {
+				p.resolveEmbedded(m, field.Type, filename, fieldPrefix+name.Name, prefix, visiting)
+				continue
+			}
+			if !p.isColumn(field.Type, settings) {
+				continue
 			}
+
+			columnName := settings["COLUMN"]
+			if columnName == "" {
+				columnName = naming.ColumnName("", name.Name)
+			}
+			_, serialized := settings["SERIALIZER"]
+			m.addColumn(fieldPrefix+name.Name, columnPrefix+columnName, field.Type, p.files[filename], serialized)
 		}
 	}
+}
 
-	if len(columns) == 0 {
-		return nil
+func (p *sourcePackage) resolveEmbedded(m *model, fieldType ast.Expr, filename, fieldPrefix, columnPrefix string, visiting map[string]bool) {
+	if star, ok := fieldType.(*ast.StarExpr); ok {
+		fieldType = star.X
 	}
 
-	columnStruct := fmt.Sprintf("type %sCols struct {\n%s\n}\n", strings.ToLower(structName), strings.Join(columns, "\n"))
-	columnVars := fmt.Sprintf("var %sCols = &%sCols{\n%s\n}\n", structName, strings.ToLower(structName), generateColumnVars(structType))
-	generatedAnnounce := strings.Repeat("// Code generated by alioth-center/database-columns. DO NOT EDIT.\n", 3)
+	switch t := fieldType.(type) {
+	case *ast.Ident:
+		structType, exist := p.structs[t.Name]
+		if !exist || visiting[t.Name] {
+			return
+		}
 
-	output := fmt.Sprintf("%s\npackage %s\n\n%s\n%s", generatedAnnounce, getPackageName(filename), columnStruct, columnVars)
+		visiting[t.Name] = true
+		p.resolveFields(m, structType, p.typeFiles[t.Name], fieldPrefix, columnPrefix, visiting)
+		delete(visiting, t.Name)
+	case *ast.SelectorExpr:
+		if ident, ok := t.X.(*ast.Ident); ok && importPathOf(p.files[filename], ident.Name) == "gorm.io/gorm" && t.Sel.Name == "Model" {
+			m.imports["time"] = "time"
+			m.imports["gorm"] = "gorm.io/gorm"
+			m.append(
+				newColumn(fieldPrefix+"ID", columnPrefix+"id", "uint"),
+				newColumn(fieldPrefix+"CreatedAt", columnPrefix+"created_at", "time.Time"),
+				newColumn(fieldPrefix+"UpdatedAt", columnPrefix+"updated_at", "time.Time"),
+				newColumn(fieldPrefix+"DeletedAt", columnPrefix+"deleted_at", "gorm.DeletedAt"),
+			)
+			return
+		}
 
-	outputFilename := strings.TrimSuffix(filename, ".go") + "_cols.gen.go"
-	err := os.WriteFile(outputFilename, []byte(output), 0o644)
-	if err != nil {
-		return err
+		// 其他包的结构体无法在当前目录中解析
+		fmt.Fprintf(os.Stderr, "skip embedded %s in %s: declared in another package\n", types.ExprString(t), m.Name)
+	}
+}
+
+// isColumn 排除 gorm 作为关联解析的字段，没有序列化器的切片、映射以及本包的结构体被视为关联
+func (p *sourcePackage) isColumn(fieldType ast.Expr, settings map[string]string) bool {
+	for _, key := range []string{"FOREIGNKEY", "REFERENCES", "MANY2MANY", "POLYMORPHIC"} {
+		if _, exist := settings[key]; exist {
+			return false
+		}
+	}
+	if _, exist := settings["SERIALIZER"]; exist {
+		return true
 	}
 
-	cmd := exec.Command("gofmt", "-w", outputFilename)
-	return cmd.Run()
+	if star, ok := fieldType.(*ast.StarExpr); ok {
+		fieldType = star.X
+	}
+	switch t := fieldType.(type) {
+	case *ast.ArrayType:
+		ident, ok := t.Elt.(*ast.Ident)
+		return ok && ident.Name == "byte"
+	case *ast.MapType, *ast.FuncType, *ast.ChanType, *ast.InterfaceType, *ast.StructType:
+		return false
+	case *ast.Ident:
+		_, isStruct := p.structs[t.Name]
+		return !isStruct
+	default:
+		return true
+	}
 }
 
-func getColumnFromTag(tag string) string {
-	tag = strings.Trim(tag, "`")
-	parts := strings.Split(tag, " ")
-	for _, part := range parts {
-		if strings.HasPrefix(part, `gorm:"`) {
-			gormTags := strings.Split(strings.TrimPrefix(part, `gorm:"`), ";")
-			for _, gormTag := range gormTags {
-				if strings.HasPrefix(gormTag, "column:") {
-					return strings.TrimPrefix(gormTag, "column:")
+func (m *model) addColumn(field, columnName string, fieldType ast.Expr, file *ast.File, serialized bool) {
+	ast.Inspect(fieldType, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok {
+				if path := importPathOf(file, ident.Name); path != "" {
+					m.imports[ident.Name] = path
 				}
 			}
+			return false
+		}
+		return true
+	})
+
+	c := newColumn(field, columnName, types.ExprString(fieldType))
+	c.Serialized = serialized
+	m.append(c)
+}
+
+// append 添加列，与已有字段同名的列被忽略，避免嵌入的结构体重复声明同名字段
+func (m *model) append(columns ...column) {
+	for _, c := range columns {
+		duplicated := false
+		for _, existing := range m.Columns {
+			duplicated = duplicated || existing.Field == c.Field
+		}
+		if !duplicated {
+			m.Columns = append(m.Columns, c)
 		}
 	}
-	return ""
 }
 
-func generateColumnVars(structType *ast.StructType) string {
-	columns := []string{}
-	for _, field := range structType.Fields.List {
-		if field.Tag != nil {
-			tag := field.Tag.Value
-			columnName := getColumnFromTag(tag)
-			if columnName != "" {
-				columns = append(columns, fmt.Sprintf("%s: \"%s\",", field.Names[0].Name, columnName))
+func newColumn(field, columnName, fieldType string) column {
+	value := strings.TrimPrefix(fieldType, "*")
+	c := column{Field: field, Column: columnName, Type: fieldType, Value: value}
+	switch value {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "time.Time":
+		c.Ordered = true
+	case "string":
+		c.Text = true
+	}
+	c.Nullable = strings.HasPrefix(fieldType, "*") || strings.HasPrefix(value, "sql.Null") || value == "gorm.DeletedAt"
+
+	return c
+}
+
+func importPathOf(file *ast.File, name string) string {
+	if file == nil {
+		return ""
+	}
+
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil {
+			if spec.Name.Name == name {
+				return path
 			}
+			continue
+		}
+		if path == name || strings.HasSuffix(path, "/"+name) {
+			return path
 		}
 	}
-	return strings.Join(columns, "\n")
+
+	return ""
 }
 
-func getPackageName(filename string) string {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, filename, nil, parser.PackageClauseOnly)
+var columnTemplate = template.Must(template.New("columns").Funcs(template.FuncMap{
+	"lower": strings.ToLower,
+}).Parse(`// Code generated by alioth-center/database-columns. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+{{- range .Imports }}
+	{{ . }}
+{{- end }}
+)
+{{ range .Models }}{{ $model := .Name }}
+type {{ lower .Name }}Cols struct {
+{{- range .Columns }}
+	{{ .Field }} string
+{{- end }}
+}
+
+var {{ .Name }}Cols = &{{ lower .Name }}Cols{
+{{- range .Columns }}
+	{{ .Field }}: "{{ .Column }}",
+{{- end }}
+}
+
+// {{ .Name }}Where is the typed filter of {{ .Name }}, it can be used as the condition of database.DatabaseV2.
+type {{ .Name }}Where struct {
+	database.Conditions
+}
+
+// New{{ .Name }}Where creates an empty {{ .Name }}Where.
+func New{{ .Name }}Where() *{{ .Name }}Where {
+	return &{{ .Name }}Where{}
+}
+{{ range .Columns }}{{ if not .Serialized }}
+func (w *{{ $model }}Where) {{ .Field }}Eq(v {{ .Value }}) *{{ $model }}Where {
+	w.Add(clause.Eq{Column: clause.Column{Name: "{{ .Column }}"}, Value: v})
+	return w
+}
+
+func (w *{{ $model }}Where) {{ .Field }}Neq(v {{ .Value }}) *{{ $model }}Where {
+	w.Add(clause.Neq{Column: clause.Column{Name: "{{ .Column }}"}, Value: v})
+	return w
+}
+
+func (w *{{ $model }}Where) {{ .Field }}In(v ...{{ .Value }}) *{{ $model }}Where {
+	values := make([]any, len(v))
+	for i := range v {
+		values[i] = v[i]
+	}
+	w.Add(clause.IN{Column: clause.Column{Name: "{{ .Column }}"}, Values: values})
+	return w
+}
+{{ if .Ordered }}
+func (w *{{ $model }}Where) {{ .Field }}Gt(v {{ .Value }}) *{{ $model }}Where {
+	w.Add(clause.Gt{Column: clause.Column{Name: "{{ .Column }}"}, Value: v})
+	return w
+}
+
+func (w *{{ $model }}Where) {{ .Field }}Gte(v {{ .Value }}) *{{ $model }}Where {
+	w.Add(clause.Gte{Column: clause.Column{Name: "{{ .Column }}"}, Value: v})
+	return w
+}
+
+func (w *{{ $model }}Where) {{ .Field }}Lt(v {{ .Value }}) *{{ $model }}Where {
+	w.Add(clause.Lt{Column: clause.Column{Name: "{{ .Column }}"}, Value: v})
+	return w
+}
+
+func (w *{{ $model }}Where) {{ .Field }}Lte(v {{ .Value }}) *{{ $model }}Where {
+	w.Add(clause.Lte{Column: clause.Column{Name: "{{ .Column }}"}, Value: v})
+	return w
+}
+{{ end }}{{ if .Text }}
+func (w *{{ $model }}Where) {{ .Field }}Like(pattern string) *{{ $model }}Where {
+	w.Add(clause.Like{Column: clause.Column{Name: "{{ .Column }}"}, Value: pattern})
+	return w
+}
+{{ end }}{{ if .Nullable }}
+func (w *{{ $model }}Where) {{ .Field }}IsNull() *{{ $model }}Where {
+	w.Add(clause.Eq{Column: clause.Column{Name: "{{ .Column }}"}, Value: nil})
+	return w
+}
+
+func (w *{{ $model }}Where) {{ .Field }}IsNotNull() *{{ $model }}Where {
+	w.Add(clause.Neq{Column: clause.Column{Name: "{{ .Column }}"}, Value: nil})
+	return w
+}
+{{ end }}{{ end }}{{ end }}
+// {{ .Name }}Update is the typed updates of {{ .Name }}, it can be used as the updates of database.DatabaseV2,
+// the zero values set are updated as well.
+type {{ .Name }}Update struct {
+	database.Updates
+}
+
+// New{{ .Name }}Update creates an empty {{ .Name }}Update.
+func New{{ .Name }}Update() *{{ .Name }}Update {
+	return &{{ .Name }}Update{}
+}
+
+func (*{{ .Name }}Update) Model() any {
+	return &{{ .Name }}{}
+}
+{{ range .Columns }}
+func (u *{{ $model }}Update) Set{{ .Field }}(v {{ .Type }}) *{{ $model }}Update {
+	u.Set("{{ .Column }}", v)
+	return u
+}
+{{ end }}{{ end }}`))
+
+func writeColumnFile(filename, packageName string, models []*model) error {
+	paths := map[string]string{"database": "github.com/alioth-center/infrastructure/database", "clause": "gorm.io/gorm/clause"}
+	for _, m := range models {
+		for name, path := range m.imports {
+			paths[name] = path
+		}
+	}
+
+	// 标准库在前，其他包在后，与 goimports 的分组一致
+	var standard, others []string
+	for name, path := range paths {
+		spec := strconv.Quote(path)
+		if path != name && !strings.HasSuffix(path, "/"+name) {
+			spec = name + " " + spec
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			others = append(others, spec)
+		} else {
+			standard = append(standard, spec)
+		}
+	}
+	sort.Strings(standard)
+	sort.Strings(others)
+	imports := standard
+	if len(standard) > 0 {
+		imports = append(imports, "")
+	}
+	imports = append(imports, others...)
+
+	var buffer bytes.Buffer
+	err := columnTemplate.Execute(&buffer, map[string]any{"Package": packageName, "Imports": imports, "Models": models})
 	if err != nil {
-		return ""
+		return err
+	}
+
+	formatted, formatErr := format.Source(buffer.Bytes())
+	if formatErr != nil {
+		return fmt.Errorf("format %s error: %w", filename, formatErr)
 	}
-	return node.Name.Name
+
+	return os.WriteFile(filename, formatted, 0o644)
 }
@@ -1,28 +1,34 @@
 package main
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/spf13/cobra"
 )
 
 func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		log.Fatalf("Error executing command: %v", err)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	var g generator
 	rootCmd := &cobra.Command{
-		Use:   "column",
-		Short: "Generate column definition files from GORM models",
-		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) != 1 {
-				log.Fatalf("Usage: column <model_path>")
-			}
-			modelPath := args[0]
-			err := generateColumnFiles(modelPath)
-			if err != nil {
-				log.Fatalf("Error generating column files: %v", err)
+		Use:          "column [--recursive] [--output <file>] <model_path>",
+		Short:        "Generate column definitions and typed query builders from GORM models",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := generateColumnFiles(args[0], g); err != nil {
+				return fmt.Errorf("generate column files error: %w", err)
 			}
+			return nil
 		},
 	}
+	rootCmd.Flags().BoolVarP(&g.recursive, "recursive", "r", false, "scan the sub directories of the model path")
+	rootCmd.Flags().StringVarP(&g.output, "output", "o", "", "generate the models of a package into the file, default is <source>_cols.gen.go beside each source file")
 
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatalf("Error executing command: %v", err)
-	}
+	return rootCmd
 }
@@ -0,0 +1,10 @@
+package billing
+
+type Invoice struct {
+	ID     uint
+	Number string `gorm:"column:invoice_no;uniqueIndex"`
+}
+
+func (Invoice) TableName() string {
+	return "invoices"
+}
@@ -0,0 +1,14 @@
+package models
+
+type Order struct {
+	ID       int64 `gorm:"primaryKey"`
+	UserID   uint
+	Amount   float64
+	Remark   *string
+	Metadata map[string]string `gorm:"serializer:json"`
+	User     User
+}
+
+func (*Order) TableName() string {
+	return "orders"
+}
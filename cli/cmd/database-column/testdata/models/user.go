@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit is embedded anonymously, its fields are the columns of the models embedding it.
+type Audit struct {
+	CreatedBy string
+	UpdatedBy string `gorm:"column:modifier"`
+}
+
+// Profile is embedded by the embedded tag with the prefix of the columns.
+type Profile struct {
+	Nickname  string
+	AvatarURL string
+}
+
+type User struct {
+	gorm.Model
+	Audit
+	FirstName, LastName string
+	Email               *string `gorm:"column:email_address"`
+	Age                 int
+	Tags                []string `gorm:"serializer:json"`
+	Profile             Profile  `gorm:"embedded;embeddedPrefix:profile_"`
+	Orders              []Order
+	Avatar              []byte
+	LoginAt             time.Time
+	Ignored             string `gorm:"-"`
+	secret              string
+}
+
+func (User) TableName() string {
+	return "users"
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerateColumnFiles(t *testing.T) {
+	cases := []struct {
+		name  string
+		args  []string
+		files []string
+	}{
+		{name: "default", files: []string{"order_cols.gen.go", "user_cols.gen.go"}},
+		{name: "recursive", args: []string{"-r", "-o", "columns.gen.go"}, files: []string{"billing/columns.gen.go", "columns.gen.go"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := copyModels(t)
+			cmd := newRootCommand()
+			cmd.SetArgs(append(c.args, dir))
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("failed to generate column files: %v", err)
+			}
+
+			if files := generatedFiles(t, dir); !slices.Equal(files, c.files) {
+				t.Fatalf("unexpected generated files: %v, expected %v", files, c.files)
+			}
+			for _, file := range c.files {
+				content, err := os.ReadFile(filepath.Join(dir, file))
+				if err != nil {
+					t.Fatalf("failed to read generated file: %v", err)
+				}
+				if bytes.Contains(content, []byte("TagsEq")) || bytes.Contains(content, []byte("MetadataIn")) {
+					t.Fatalf("expected no filters of the serialized columns in %s", file)
+				}
+
+				golden := filepath.Join("testdata", "golden", c.name, file+".golden")
+				if *update {
+					_ = os.MkdirAll(filepath.Dir(golden), 0o755)
+					_ = os.WriteFile(golden, content, 0o644)
+				}
+				expected, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("failed to read golden file: %v", err)
+				}
+				if !bytes.Equal(content, expected) {
+					t.Fatalf("generated %s differs from %s, run go test with -update to accept it:\n%s", file, golden, content)
+				}
+			}
+
+			compileModels(t, dir)
+		})
+	}
+}
+
+// copyModels copies the models in the testdata into a temporary package of the module, so the generated files
+// are compiled with the dependencies of the module, and the testdata is not modified.
+func copyModels(t *testing.T) string {
+	dir, err := os.MkdirTemp("testdata", "generated-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	source := filepath.Join("testdata", "models")
+	err = filepath.WalkDir(source, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		relative, _ := filepath.Rel(source, path)
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, relative), 0o755)
+		}
+		content, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return readErr
+		}
+		return os.WriteFile(filepath.Join(dir, relative), content, 0o644)
+	})
+	if err != nil {
+		t.Fatalf("failed to copy models: %v", err)
+	}
+
+	return dir
+}
+
+func generatedFiles(t *testing.T, dir string) (files []string) {
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && strings.HasSuffix(path, ".gen.go") {
+			relative, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(relative))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to list generated files: %v", err)
+	}
+
+	slices.Sort(files)
+	return files
+}
+
+// compileModels type checks the models with the generated files by go vet.
+func compileModels(t *testing.T, dir string) {
+	if testing.Short() {
+		t.Skip("skip compiling the generated files in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("skip compiling the generated files without the go command")
+	}
+
+	output, err := exec.Command("go", "vet", "./"+filepath.ToSlash(dir)+"/...").CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to compile the generated files: %v\n%s", err, output)
+	}
+}
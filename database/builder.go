@@ -0,0 +1,86 @@
+package database
+
+import (
+	"gorm.io/gorm/clause"
+)
+
+// ColumnUpdates is the column values to update of a model, the update methods of DatabaseV2 update the
+// columns of Model() with Columns(), the zero values included. The update builders generated by
+// database-column implement it.
+type ColumnUpdates interface {
+	Model() any
+	Columns() map[string]any
+}
+
+// Conditions is the conditions joined by AND, it is a clause.Expression which can be used as the condition
+// of DatabaseV2, and it is the base of the filter builders generated by database-column.
+//
+// example:
+//
+//	conditions := &database.Conditions{}
+//	conditions.Add(clause.Eq{Column: clause.Column{Name: "name"}, Value: "Alice"})
+//	err := db.GetDataByCustomCondition(ctx, &users, conditions)
+type Conditions struct {
+	expressions []clause.Expression
+}
+
+// Add appends the expressions to the conditions.
+func (c *Conditions) Add(expressions ...clause.Expression) {
+	c.expressions = append(c.expressions, expressions...)
+}
+
+// Empty reports whether there is no condition, the empty conditions are rejected by DatabaseV2 like the
+// empty slices.
+func (c *Conditions) Empty() bool {
+	return len(c.expressions) == 0
+}
+
+func (c *Conditions) Build(builder clause.Builder) {
+	if len(c.expressions) == 0 {
+		return
+	}
+
+	clause.And(c.expressions...).Build(builder)
+}
+
+// Updates is the column values to update, it is the base of the update builders generated by database-column,
+// which implement ColumnUpdates by adding the Model method.
+type Updates struct {
+	columns map[string]any
+}
+
+// Set sets the value of the column.
+func (u *Updates) Set(column string, value any) {
+	if u.columns == nil {
+		u.columns = map[string]any{}
+	}
+
+	u.columns[column] = value
+}
+
+// Columns returns the column values to update.
+func (u *Updates) Columns() map[string]any {
+	return u.columns
+}
+
+// EmptyCondition reports whether the condition is nil, an empty slice or empty Conditions.
+func EmptyCondition(condition any) bool {
+	if condition == nil || EmptySlice(condition) {
+		return true
+	}
+
+	if conditions, ok := condition.(interface{ Empty() bool }); ok {
+		return conditions.Empty()
+	}
+
+	return false
+}
+
+// updatesOf returns the model and the values to update, the ColumnUpdates are split into them.
+func updatesOf(updates any) (model, values any) {
+	if columnUpdates, ok := updates.(ColumnUpdates); ok {
+		return columnUpdates.Model(), columnUpdates.Columns()
+	}
+
+	return updates, updates
+}
@@ -0,0 +1,439 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/alioth-center/infrastructure/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type ChangeOperation string
+
+const (
+	ChangeCreate ChangeOperation = "create"
+	ChangeUpdate ChangeOperation = "update"
+	ChangeDelete ChangeOperation = "delete"
+)
+
+type DeliveryMode int
+
+const (
+	// DeliverInTransaction calls the handler in the transaction of the operation before it is committed,
+	// the error of the handler fails the operation and rolls it back.
+	DeliverInTransaction DeliveryMode = iota
+	// DeliverAsync calls the handler in a new goroutine after the operation is committed, the error of the
+	// handler is logged. The changes in a transaction run by DatabaseV2.Transaction are delivered after the
+	// transaction is committed and discarded if it is rolled back, the changes in the transactions started
+	// by gorm directly are delivered before the transaction is committed.
+	DeliverAsync
+)
+
+const (
+	changeOldRowsKey = "changes:old_rows"
+	changeAsyncKey   = "changes:async"
+)
+
+// changePair is a changed row, the old and new values are pointers to the model, nil if absent.
+type changePair struct {
+	old, new any
+}
+
+type changeSubscriber struct {
+	id        uint64
+	operation ChangeOperation
+	mode      DeliveryMode
+	deliver   func(ctx context.Context, pair changePair) error
+}
+
+type asyncDelivery struct {
+	subscriber *changeSubscriber
+	pairs      []changePair
+}
+
+type changeQueueKey struct{}
+
+// changeQueue keeps the async deliveries of the changes in a transaction until the transaction is committed.
+type changeQueue struct {
+	mu      sync.Mutex
+	pending []func()
+	done    bool
+}
+
+// add keeps the deliveries, they are started immediately if the transaction of the queue is finished.
+func (q *changeQueue) add(deliveries ...func()) {
+	q.mu.Lock()
+	if !q.done {
+		q.pending = append(q.pending, deliveries...)
+		q.mu.Unlock()
+		return
+	}
+	q.mu.Unlock()
+
+	for _, deliver := range deliveries {
+		deliver()
+	}
+}
+
+// take finishes the queue and returns the kept deliveries.
+func (q *changeQueue) take() []func() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := q.pending
+	q.pending, q.done = nil, true
+	return pending
+}
+
+// runTransaction runs fn in a transaction of db, the async deliveries of the changes in the transaction are
+// started after it is committed and discarded if it is rolled back. The deliveries of a nested transaction
+// join the outer transaction.
+func runTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	parent, _ := db.Statement.Context.Value(changeQueueKey{}).(*changeQueue)
+	queue := &changeQueue{}
+	err := db.WithContext(context.WithValue(db.Statement.Context, changeQueueKey{}, queue)).Transaction(fn)
+	deliveries := queue.take()
+	if err != nil {
+		return err
+	}
+
+	if parent != nil {
+		parent.add(deliveries...)
+		return nil
+	}
+	for _, deliver := range deliveries {
+		deliver()
+	}
+
+	return nil
+}
+
+var changeSubscribers = struct {
+	mu     sync.RWMutex
+	next   uint64
+	byType map[reflect.Type][]*changeSubscriber
+}{byType: map[reflect.Type][]*changeSubscriber{}}
+
+// AfterCreate subscribes the created rows of the model T, the handler receives the created values with
+// the generated fields such as the auto increment id.
+//
+// Parameters:
+//
+//	handler (func(ctx context.Context, created *T) error): The handler called for every created row.
+//	mode (DeliveryMode): DeliverInTransaction or DeliverAsync.
+//
+// Returns:
+//
+//	unsubscribe (func()): The function removing the subscription.
+//
+// example:
+//
+//	unsubscribe := database.AfterCreate(func(ctx context.Context, user *User) error {
+//		return events.Publish(ctx, UserRegistered{ID: user.ID})
+//	}, database.DeliverAsync)
+func AfterCreate[T any](handler func(ctx context.Context, created *T) error, mode DeliveryMode) (unsubscribe func()) {
+	return subscribeChanges[T](ChangeCreate, mode, func(ctx context.Context, _, created *T) error {
+		return handler(ctx, created)
+	})
+}
+
+// AfterUpdate subscribes the updated rows of the model T, the handler receives the values before and after
+// the update, the new value is nil if the model has no primary key to reload the row.
+//
+// example:
+//
+//	unsubscribe := database.AfterUpdate(func(ctx context.Context, old, new *User) error {
+//		return cache.Delete(ctx, "user:"+strconv.Itoa(old.ID))
+//	}, database.DeliverInTransaction)
+func AfterUpdate[T any](handler func(ctx context.Context, old, new *T) error, mode DeliveryMode) (unsubscribe func()) {
+	return subscribeChanges[T](ChangeUpdate, mode, handler)
+}
+
+// AfterDelete subscribes the deleted rows of the model T, including the soft deleted ones, the handler
+// receives the values before the deletion.
+func AfterDelete[T any](handler func(ctx context.Context, deleted *T) error, mode DeliveryMode) (unsubscribe func()) {
+	return subscribeChanges[T](ChangeDelete, mode, func(ctx context.Context, deleted, _ *T) error {
+		return handler(ctx, deleted)
+	})
+}
+
+func subscribeChanges[T any](operation ChangeOperation, mode DeliveryMode, handler func(ctx context.Context, old, new *T) error) (unsubscribe func()) {
+	modelType := reflect.TypeOf((*T)(nil)).Elem()
+	for modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	changeSubscribers.mu.Lock()
+	defer changeSubscribers.mu.Unlock()
+	changeSubscribers.next++
+	subscriber := &changeSubscriber{
+		id:        changeSubscribers.next,
+		operation: operation,
+		mode:      mode,
+		deliver: func(ctx context.Context, pair changePair) error {
+			old, _ := pair.old.(*T)
+			updated, _ := pair.new.(*T)
+			return handler(ctx, old, updated)
+		},
+	}
+	changeSubscribers.byType[modelType] = append(changeSubscribers.byType[modelType], subscriber)
+
+	return func() {
+		changeSubscribers.mu.Lock()
+		defer changeSubscribers.mu.Unlock()
+
+		subscribers := changeSubscribers.byType[modelType]
+		for i, existing := range subscribers {
+			if existing.id == subscriber.id {
+				changeSubscribers.byType[modelType] = append(subscribers[:i:i], subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func subscribersOf(db *gorm.DB, operation ChangeOperation) (subscribers []*changeSubscriber) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil
+	}
+
+	changeSubscribers.mu.RLock()
+	defer changeSubscribers.mu.RUnlock()
+	for _, subscriber := range changeSubscribers.byType[db.Statement.Schema.ModelType] {
+		if subscriber.operation == operation {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+
+	return subscribers
+}
+
+// RegisterChangeCallbacks registers the gorm callbacks delivering the changes to the handlers subscribed by
+// AfterCreate, AfterUpdate and AfterDelete, the drivers register them when the database is opened. The rows
+// are loaded only if the model has subscribers, and raw sql is not captured.
+//
+// Parameters:
+//
+//	db (*gorm.DB): The gorm database to register the callbacks.
+//	log (logger.Logger): The logger of the async delivery errors, default is logger.Default().
+//
+// Returns:
+//
+//	err (error): An error if the callbacks fail to register, otherwise nil.
+func RegisterChangeCallbacks(db *gorm.DB, log logger.Logger) error {
+	if log == nil {
+		log = logger.Default()
+	}
+
+	deliverAsync := func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+
+		value, exist := db.InstanceGet(changeAsyncKey)
+		if !exist {
+			return
+		}
+
+		ctx := context.WithoutCancel(db.Statement.Context)
+		deliveries := make([]func(), 0, len(value.([]asyncDelivery)))
+		for _, delivery := range value.([]asyncDelivery) {
+			deliveries = append(deliveries, func() {
+				go func() {
+					for _, pair := range delivery.pairs {
+						if err := delivery.subscriber.deliver(ctx, pair); err != nil {
+							log.Error(logger.NewFields(ctx).WithMessage("deliver change failed").WithData(map[string]any{
+								"operation": delivery.subscriber.operation,
+								"error":     err.Error(),
+							}))
+						}
+					}
+				}()
+			})
+		}
+
+		// the statement in an outer transaction keeps the connection of the transaction after its callbacks
+		if queue, ok := ctx.Value(changeQueueKey{}).(*changeQueue); ok {
+			if _, inTransaction := db.Statement.ConnPool.(gorm.TxCommitter); inTransaction {
+				queue.add(deliveries...)
+				return
+			}
+		}
+		for _, deliver := range deliveries {
+			deliver()
+		}
+	}
+
+	callbacks := db.Callback()
+	registers := []error{
+		callbacks.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("changes:after_create", afterCreateChanges),
+		callbacks.Create().After("gorm:commit_or_rollback_transaction").Register("changes:deliver_create", deliverAsync),
+		callbacks.Update().Before("gorm:update").Register("changes:before_update", beforeChanges(ChangeUpdate)),
+		callbacks.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("changes:after_update", afterUpdateChanges),
+		callbacks.Update().After("gorm:commit_or_rollback_transaction").Register("changes:deliver_update", deliverAsync),
+		callbacks.Delete().Before("gorm:delete").Register("changes:before_delete", beforeChanges(ChangeDelete)),
+		callbacks.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("changes:after_delete", afterDeleteChanges),
+		callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register("changes:deliver_delete", deliverAsync),
+	}
+	for _, registerErr := range registers {
+		if registerErr != nil {
+			return fmt.Errorf("register change callback error: %w", registerErr)
+		}
+	}
+
+	return nil
+}
+
+func afterCreateChanges(db *gorm.DB) {
+	subscribers := subscribersOf(db, ChangeCreate)
+	if len(subscribers) == 0 || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	var pairs []changePair
+	switch value := reflect.Indirect(db.Statement.ReflectValue); value.Kind() {
+	case reflect.Struct:
+		if value.Type() == db.Statement.Schema.ModelType {
+			pairs = append(pairs, changePair{new: copyModel(value)})
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if row := reflect.Indirect(value.Index(i)); row.Type() == db.Statement.Schema.ModelType {
+				pairs = append(pairs, changePair{new: copyModel(row)})
+			}
+		}
+	default:
+		return
+	}
+
+	dispatchChanges(db, subscribers, pairs)
+}
+
+func beforeChanges(operation ChangeOperation) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if len(subscribersOf(db, operation)) == 0 {
+			return
+		}
+
+		rows := reflect.New(reflect.SliceOf(db.Statement.Schema.ModelType))
+		if err := LoadAffectedRows(db, rows.Interface()); err != nil {
+			_ = db.AddError(fmt.Errorf("load changed rows error: %w", err))
+			return
+		}
+		db.InstanceSet(changeOldRowsKey, rows.Elem())
+	}
+}
+
+func afterUpdateChanges(db *gorm.DB) {
+	subscribers := subscribersOf(db, ChangeUpdate)
+	oldRows, exist := oldRowsOf(db)
+	if len(subscribers) == 0 || !exist || db.Statement.RowsAffected == 0 || oldRows.Len() == 0 {
+		return
+	}
+
+	newRows := map[string]reflect.Value{}
+	if primaryFields := db.Statement.Schema.PrimaryFields; len(primaryFields) > 0 {
+		query := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Unscoped().Model(reflect.New(db.Statement.Schema.ModelType).Interface())
+		if db.Statement.Table != "" {
+			query = query.Table(db.Statement.Table)
+		}
+
+		_, primaryValues := schema.GetIdentityFieldValuesMap(db.Statement.Context, oldRows, primaryFields)
+		column, queryValues := schema.ToQueryValues(clause.CurrentTable, db.Statement.Schema.PrimaryFieldDBNames, primaryValues)
+		rows := reflect.New(reflect.SliceOf(db.Statement.Schema.ModelType))
+		if err := query.Clauses(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: queryValues}}}).Find(rows.Interface()).Error; err != nil {
+			_ = db.AddError(fmt.Errorf("load changed rows error: %w", err))
+			return
+		}
+		for i := 0; i < rows.Elem().Len(); i++ {
+			row := rows.Elem().Index(i)
+			newRows[primaryKeyOfRow(db, row)] = row
+		}
+	}
+
+	pairs := make([]changePair, 0, oldRows.Len())
+	for i := 0; i < oldRows.Len(); i++ {
+		pair := changePair{old: copyModel(oldRows.Index(i))}
+		if row, found := newRows[primaryKeyOfRow(db, oldRows.Index(i))]; found {
+			pair.new = copyModel(row)
+		}
+		pairs = append(pairs, pair)
+	}
+
+	dispatchChanges(db, subscribers, pairs)
+}
+
+func afterDeleteChanges(db *gorm.DB) {
+	subscribers := subscribersOf(db, ChangeDelete)
+	oldRows, exist := oldRowsOf(db)
+	if len(subscribers) == 0 || !exist || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	pairs := make([]changePair, 0, oldRows.Len())
+	for i := 0; i < oldRows.Len(); i++ {
+		pairs = append(pairs, changePair{old: copyModel(oldRows.Index(i))})
+	}
+
+	dispatchChanges(db, subscribers, pairs)
+}
+
+// dispatchChanges calls the in-transaction handlers and keeps the async deliveries for the callback
+// after the commit, the first error of the in-transaction handlers fails the operation.
+func dispatchChanges(db *gorm.DB, subscribers []*changeSubscriber, pairs []changePair) {
+	if len(pairs) == 0 {
+		return
+	}
+
+	var deliveries []asyncDelivery
+	for _, subscriber := range subscribers {
+		if subscriber.mode == DeliverAsync {
+			deliveries = append(deliveries, asyncDelivery{subscriber: subscriber, pairs: pairs})
+			continue
+		}
+
+		for _, pair := range pairs {
+			if err := subscriber.deliver(db.Statement.Context, pair); err != nil {
+				_ = db.AddError(fmt.Errorf("deliver %s change error: %w", subscriber.operation, err))
+				return
+			}
+		}
+	}
+
+	if len(deliveries) > 0 {
+		db.InstanceSet(changeAsyncKey, deliveries)
+	}
+}
+
+func oldRowsOf(db *gorm.DB) (rows reflect.Value, exist bool) {
+	value, exist := db.InstanceGet(changeOldRowsKey)
+	if !exist {
+		return reflect.Value{}, false
+	}
+
+	rows, exist = value.(reflect.Value)
+	return rows, exist
+}
+
+// copyModel copies the row into a new pointer to the model, so the handlers do not share the values
+// with the caller.
+func copyModel(row reflect.Value) any {
+	copied := reflect.New(row.Type())
+	copied.Elem().Set(row)
+	return copied.Interface()
+}
+
+func primaryKeyOfRow(db *gorm.DB, row reflect.Value) string {
+	keys := make([]string, 0, len(db.Statement.Schema.PrimaryFields))
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		value, _ := field.ValueOf(db.Statement.Context, row)
+		keys = append(keys, fmt.Sprint(value))
+	}
+
+	return strings.Join(keys, ",")
+}
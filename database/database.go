@@ -10,12 +10,15 @@ import (
 )
 
 type Options struct {
-	DataSource string
-	MaxIdle    int
-	MaxOpen    int
-	MaxLife    time.Duration
-	Timeout    time.Duration
-	Logger     logger.Logger
+	DataSource      string
+	MaxIdle         int
+	MaxOpen         int
+	MaxLife         time.Duration
+	Timeout         time.Duration
+	Logger          logger.Logger
+	SlowThreshold   time.Duration
+	SqlSampleRate   float64
+	RedactSqlParams bool
 }
 
 // Database is the interface that wraps the basic database operations.
@@ -70,6 +73,17 @@ type DatabaseV2 interface {
 	//	*gorm.DB: The GORM database instance with the provided context.
 	GetGormCore(ctx context.Context) *gorm.DB
 
+	// Transaction runs fn in a transaction with the provided context, it is committed if fn returns nil and
+	// rolled back otherwise. The changes delivered by DeliverAsync in it are delivered after the commit.
+	//
+	// Parameters:
+	//	ctx (context.Context): The context for the transaction, it is not bounded by the timeout of the operations.
+	//	fn (func(tx *gorm.DB) error): The function executed in the transaction, it should use tx for the queries.
+	//
+	// Returns:
+	//	error: An error if fn or the transaction fails, otherwise nil.
+	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
+
 	// GetDataBySingleCondition retrieves data from the database based on a single column condition.
 	// The result is stored in the receiver.
 	//
@@ -85,7 +99,7 @@ type DatabaseV2 interface {
 	GetDataBySingleCondition(ctx context.Context, receiver any, column string, condition any, needFields ...string) error
 
 	// GetDataByCustomCondition retrieves data from the database based on a custom condition.
-	// The result is stored in the receiver.
+	// The result is stored in the receiver, use StreamData to iterate the large results instead.
 	//
 	// Parameters:
 	//	ctx (context.Context): The context for the database operation.
@@ -137,11 +151,29 @@ type DatabaseV2 interface {
 	//	error: An error if the operation fails, otherwise nil.
 	CreateDataOnDuplicateKeyUpdate(ctx context.Context, data any, indexKeys, updateFields []string) error
 
+	// BatchUpsert creates the rows in the database or updates them if a duplicate key is found, the rows are
+	// split into chunks so that a statement never exceeds the placeholder limit of the driver.
+	//
+	// Parameters:
+	//	ctx (context.Context): The context for the database operation.
+	//	rows (any): The slice or the array of data records to be created or updated.
+	//	batchSize (int): The max rows in a statement, 0 means as many as the driver allows.
+	//	indexKeys ([]string): The index keys to check for duplication, ignored by mysql.
+	//	updateFields ([]string): The fields to update if a duplicate key is found.
+	//	inTransaction (bool): Whether to run all chunks in one transaction.
+	//
+	// Returns:
+	//	result (UpsertResult): The affected rows, inserted and updated counts are reported by mysql only.
+	//	err (error): An error if the operation fails, otherwise nil.
+	BatchUpsert(ctx context.Context, rows any, batchSize int, indexKeys, updateFields []string, inTransaction bool) (result UpsertResult, err error)
+
 	// UpdateDataBySingleCondition updates data in the database based on a single column condition.
+	// If the updates is a struct with a field tagged lock:"version", the update only matches the rows
+	// with the same version and increases it, ErrStaleData is returned when no row is updated.
 	//
 	// Parameters:
 	//	ctx (context.Context): The context for the database operation.
-	//	updates (any): The data to be updated.
+	//	updates (any): The data to be updated, or ColumnUpdates to update the columns including zero values.
 	//	column (string): The column name to apply the condition.
 	//	condition (any): The condition value for the specified column.
 	//
@@ -150,17 +182,59 @@ type DatabaseV2 interface {
 	UpdateDataBySingleCondition(ctx context.Context, updates any, column string, condition any) error
 
 	// UpdateDataByCustomCondition updates data in the database based on a custom condition.
+	// The version column of the updates is checked and increased as UpdateDataBySingleCondition does.
 	//
 	// Parameters:
 	//	ctx (context.Context): The context for the database operation.
-	//	updates (any): The data to be updated.
+	//	updates (any): The data to be updated, or ColumnUpdates to update the columns including zero values.
 	//	condition (any): The custom condition for the query.
 	//
 	// Returns:
 	//	error: An error if the operation fails, otherwise nil.
 	UpdateDataByCustomCondition(ctx context.Context, updates, condition any) error
 
+	// SoftDeleteData soft deletes data in the database based on a custom condition, the model must
+	// contain a gorm.DeletedAt field, otherwise ErrSoftDeleteUnsupported is returned.
+	//
+	// Parameters:
+	//	ctx (context.Context): The context for the database operation.
+	//	model (any): The model of the data to be soft deleted.
+	//	condition (any): The custom condition for the query.
+	//
+	// Returns:
+	//	error: An error if the operation fails, otherwise nil.
+	SoftDeleteData(ctx context.Context, model, condition any) error
+
+	// RestoreData restores the soft deleted data in the database based on a custom condition.
+	//
+	// Parameters:
+	//	ctx (context.Context): The context for the database operation.
+	//	model (any): The model of the data to be restored.
+	//	condition (any): The custom condition for the query.
+	//
+	// Returns:
+	//	error: An error if the operation fails, otherwise nil.
+	RestoreData(ctx context.Context, model, condition any) error
+
+	// ListDataWithDeleted retrieves a paginated list of data, including the soft deleted data, from the
+	// database based on the provided filter and ordering. The result is stored in the receiver.
+	//
+	// Parameters:
+	//	ctx (context.Context): The context for the database operation.
+	//	receiver (any): The destination where the query result will be stored.
+	//	filter (any): The filter condition for the query.
+	//	order (string): The column name to order by.
+	//	desc (bool): Whether to order in descending order.
+	//	offset (int): The offset for pagination.
+	//	limit (int): The limit for pagination.
+	//	needFields (...string): Optional fields to select in the query.
+	//
+	// Returns:
+	//	error: An error if the operation fails, otherwise nil.
+	ListDataWithDeleted(ctx context.Context, receiver any, filter any, order string, desc bool, offset, limit int, needFields ...string) error
+
 	// ExecuteRawSqlTemplateQuery executes a raw SQL template query with the provided context.
+	// The template values are substituted into the SQL text, prefer ExecuteNamedSqlQuery for user input.
 	//
 	// Parameters:
 	//	ctx (context.Context): The context for the database operation.
@@ -173,6 +247,7 @@ type DatabaseV2 interface {
 	ExecuteRawSqlTemplateQuery(ctx context.Context, receiver any, sql string, template RawSqlTemplate) error
 
 	// ExecuteRawSqlTemplate executes a raw SQL template with the provided context.
+	// The template values are substituted into the SQL text, prefer ExecuteNamedSql for user input.
 	//
 	// Parameters:
 	//	ctx (context.Context): The context for the database operation.
@@ -183,6 +258,31 @@ type DatabaseV2 interface {
 	//	error: An error if the operation fails, otherwise nil.
 	ExecuteRawSqlTemplate(ctx context.Context, sql string, template RawSqlTemplate) error
 
+	// ExecuteNamedSqlQuery executes a named-parameter SQL query with the provided context, the parameters
+	// are bound as driver parameters, see NamedSql for the syntax.
+	//
+	// Parameters:
+	//	ctx (context.Context): The context for the database operation.
+	//	receiver (any): The destination where the query result will be stored.
+	//	sql (string): The SQL template with named parameters, such as :id or @id.
+	//	params (map[string]any): The values of the named parameters.
+	//
+	// Returns:
+	//	error: An error if the template is invalid, the params are incomplete or the operation fails, otherwise nil.
+	ExecuteNamedSqlQuery(ctx context.Context, receiver any, sql string, params map[string]any) error
+
+	// ExecuteNamedSql executes a named-parameter SQL with the provided context, the parameters
+	// are bound as driver parameters, see NamedSql for the syntax.
+	//
+	// Parameters:
+	//	ctx (context.Context): The context for the database operation.
+	//	sql (string): The SQL template with named parameters, such as :id or @id.
+	//	params (map[string]any): The values of the named parameters.
+	//
+	// Returns:
+	//	error: An error if the template is invalid, the params are incomplete or the operation fails, otherwise nil.
+	ExecuteNamedSql(ctx context.Context, sql string, params map[string]any) error
+
 	// ExecuteRawSqlQuery executes a raw SQL query with the provided context.
 	//
 	// Parameters:
@@ -203,4 +303,19 @@ type DatabaseV2 interface {
 	// Returns:
 	//	error: An error if the operation fails, otherwise nil.
 	ExecuteRawSql(ctx context.Context, sql string) error
+
+	// HealthCheck pings the database, it can be used by the readiness probes.
+	//
+	// Parameters:
+	//	ctx (context.Context): The context for the ping, it should carry a timeout.
+	//
+	// Returns:
+	//	error: An error if the database is unreachable, otherwise nil.
+	HealthCheck(ctx context.Context) error
+
+	// PoolStats returns the statistics of the connection pool.
+	//
+	// Returns:
+	//	PoolStats: The open, idle, in-use and wait statistics of the connection pool.
+	PoolStats() PoolStats
 }
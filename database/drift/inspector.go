@@ -0,0 +1,387 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alioth-center/infrastructure/database"
+	"github.com/alioth-center/infrastructure/utils/values"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Report is the drift between the models and the live schema of the database.
+type Report struct {
+	Driver string
+	Tables []TableDrift
+}
+
+// TableDrift is the drift of a table, the table is missing in the database if Missing is true, and the
+// other fields are empty in that case.
+type TableDrift struct {
+	Table           string
+	Model           string
+	Missing         bool
+	MissingColumns  []string
+	ExtraColumns    []string
+	TypeMismatches  []Mismatch
+	MissingIndexes  []string
+	ExtraIndexes    []string
+	IndexMismatches []Mismatch
+	// Draft is the sql migrating the table to the model, the destructive statements are commented out.
+	Draft []string
+}
+
+// Mismatch is a column or an index whose definition differs between the model and the database.
+type Mismatch struct {
+	Name     string
+	Expected string
+	Actual   string
+}
+
+// HasDrift reports whether any table drifts.
+func (r *Report) HasDrift() bool {
+	return len(r.Tables) > 0
+}
+
+// MigrationDraft returns the sql migrating the database to the models, it is a draft to review, the drops
+// of the extra columns and indexes are commented out.
+func (r *Report) MigrationDraft() string {
+	builder := strings.Builder{}
+	for _, table := range r.Tables {
+		builder.WriteString(values.BuildStrings("-- ", table.Table, " (", table.Model, ")\n"))
+		for _, statement := range table.Draft {
+			builder.WriteString(strings.TrimSuffix(statement, ";"))
+			builder.WriteString(";\n")
+		}
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+func (r *Report) String() string {
+	if !r.HasDrift() {
+		return "no schema drift\n"
+	}
+
+	builder := strings.Builder{}
+	for _, table := range r.Tables {
+		builder.WriteString(values.BuildStrings("table ", table.Table, " (", table.Model, "):\n"))
+		if table.Missing {
+			builder.WriteString("  missing table\n")
+			continue
+		}
+
+		writeNames := func(title string, names []string) {
+			if len(names) > 0 {
+				builder.WriteString(values.BuildStrings("  ", title, ": ", strings.Join(names, ", "), "\n"))
+			}
+		}
+		writeMismatches := func(title string, mismatches []Mismatch) {
+			for _, mismatch := range mismatches {
+				builder.WriteString(fmt.Sprintf("  %s %s: expected %s, actual %s\n", title, mismatch.Name, mismatch.Expected, mismatch.Actual))
+			}
+		}
+		writeNames("missing columns", table.MissingColumns)
+		writeNames("extra columns", table.ExtraColumns)
+		writeMismatches("column type", table.TypeMismatches)
+		writeNames("missing indexes", table.MissingIndexes)
+		writeNames("extra indexes", table.ExtraIndexes)
+		writeMismatches("index", table.IndexMismatches)
+	}
+
+	return builder.String()
+}
+
+// Inspect reads the live schema of the tables by the migrator of the driver, which queries the
+// information_schema, pg_catalog or sqlite_master, and diffs it against the models. The models registered by
+// database.RegisterModels are inspected if no model is given.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for the database operation.
+//	db (database.DatabaseV2): The database to inspect.
+//	models (...any): The models to diff, default is database.RegisteredModels().
+//
+// Returns:
+//
+//	report (*Report): The drift of the tables, only the drifted tables are reported.
+//	err (error): An error if the schema cannot be read, or ErrNoModels if no model is given or registered.
+//
+// example:
+//
+//	report, err := drift.Inspect(ctx, db, &User{}, &Order{})
+//	if report.HasDrift() {
+//		fmt.Print(report, report.MigrationDraft())
+//	}
+func Inspect(ctx context.Context, db database.DatabaseV2, models ...any) (report *Report, err error) {
+	if len(models) == 0 {
+		models = database.RegisteredModels()
+	}
+	if len(models) == 0 {
+		return nil, ErrNoModels
+	}
+
+	core := db.GetGormCore(ctx)
+	report = &Report{Driver: core.Dialector.Name()}
+	for _, model := range models {
+		table, inspectErr := inspectTable(core, model)
+		if inspectErr != nil {
+			return nil, inspectErr
+		}
+		if table != nil {
+			report.Tables = append(report.Tables, *table)
+		}
+	}
+
+	return report, nil
+}
+
+func inspectTable(db *gorm.DB, model any) (*TableDrift, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("parse model %T error: %w", model, err)
+	}
+
+	table := &TableDrift{Table: stmt.Table, Model: stmt.Schema.Name}
+	migrator := db.Migrator()
+	if !migrator.HasTable(model) {
+		table.Missing = true
+		table.Draft = draft(db, false, func(m gorm.Migrator) error { return m.CreateTable(model) })
+		return table, nil
+	}
+
+	columnTypes, err := migrator.ColumnTypes(model)
+	if err != nil {
+		return nil, fmt.Errorf("read columns of %s error: %w", stmt.Table, err)
+	}
+	indexes, err := migrator.GetIndexes(model)
+	if err != nil {
+		return nil, fmt.Errorf("read indexes of %s error: %w", stmt.Table, err)
+	}
+
+	diffColumns(db, table, stmt.Schema, model, columnTypes)
+	diffIndexes(db, table, stmt.Schema, model, indexes)
+	if len(table.MissingColumns)+len(table.ExtraColumns)+len(table.TypeMismatches)+
+		len(table.MissingIndexes)+len(table.ExtraIndexes)+len(table.IndexMismatches) == 0 {
+		return nil, nil
+	}
+
+	return table, nil
+}
+
+func diffColumns(db *gorm.DB, table *TableDrift, modelSchema *schema.Schema, model any, columnTypes []gorm.ColumnType) {
+	live := make(map[string]gorm.ColumnType, len(columnTypes))
+	for _, columnType := range columnTypes {
+		live[strings.ToLower(columnType.Name())] = columnType
+	}
+
+	expected := map[string]bool{}
+	for _, field := range modelSchema.Fields {
+		if field.DBName == "" || field.IgnoreMigration {
+			continue
+		}
+
+		expected[strings.ToLower(field.DBName)] = true
+		columnType, exist := live[strings.ToLower(field.DBName)]
+		if !exist {
+			table.MissingColumns = append(table.MissingColumns, field.DBName)
+			table.Draft = append(table.Draft, draft(db, false, func(m gorm.Migrator) error { return m.AddColumn(model, field.Name) })...)
+			continue
+		}
+
+		expectedType, actualType := db.Dialector.DataTypeOf(field), liveTypeOf(columnType)
+		if !sameType(expectedType, actualType) {
+			table.TypeMismatches = append(table.TypeMismatches, Mismatch{Name: field.DBName, Expected: expectedType, Actual: actualType})
+			if db.Dialector.Name() == "sqlite" {
+				// sqlite alters the column by recreating the table, which cannot be drafted without the data
+				table.Draft = append(table.Draft, values.BuildStrings("-- sqlite cannot alter ", table.Table, ".", field.DBName, " to ", expectedType, ", recreate the table"))
+			} else {
+				table.Draft = append(table.Draft, draft(db, false, func(m gorm.Migrator) error { return m.AlterColumn(model, field.Name) })...)
+			}
+		}
+	}
+
+	for _, columnType := range columnTypes {
+		if !expected[strings.ToLower(columnType.Name())] {
+			name := columnType.Name()
+			table.ExtraColumns = append(table.ExtraColumns, name)
+			if db.Dialector.Name() == "sqlite" {
+				// the sqlite migrator drops the column by recreating the table, sqlite 3.35 supports dropping it directly
+				table.Draft = append(table.Draft, values.BuildStrings("-- ALTER TABLE `", table.Table, "` DROP COLUMN `", name, "`"))
+			} else {
+				table.Draft = append(table.Draft, draft(db, true, func(m gorm.Migrator) error { return m.DropColumn(model, name) })...)
+			}
+		}
+	}
+}
+
+func diffIndexes(db *gorm.DB, table *TableDrift, modelSchema *schema.Schema, model any, indexes []gorm.Index) {
+	live := make(map[string]gorm.Index, len(indexes))
+	for _, index := range indexes {
+		if primary, _ := index.PrimaryKey(); primary || strings.HasPrefix(index.Name(), "sqlite_autoindex_") {
+			continue
+		}
+		live[index.Name()] = index
+	}
+
+	expectedIndexes := modelSchema.ParseIndexes()
+	names := make([]string, 0, len(expectedIndexes))
+	for name := range expectedIndexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		index := expectedIndexes[name]
+		columns := make([]string, 0, len(index.Fields))
+		for _, option := range index.Fields {
+			columns = append(columns, option.DBName)
+		}
+		expected := describeIndex(columns, index.Class == "UNIQUE")
+
+		liveIndex, exist := live[name]
+		if !exist {
+			table.MissingIndexes = append(table.MissingIndexes, name)
+			table.Draft = append(table.Draft, draft(db, false, func(m gorm.Migrator) error { return m.CreateIndex(model, name) })...)
+			continue
+		}
+
+		unique, _ := liveIndex.Unique()
+		if actual := describeIndex(liveIndex.Columns(), unique); actual != expected {
+			table.IndexMismatches = append(table.IndexMismatches, Mismatch{Name: name, Expected: expected, Actual: actual})
+			table.Draft = append(table.Draft, draft(db, false, func(m gorm.Migrator) error { return m.DropIndex(model, name) })...)
+			table.Draft = append(table.Draft, draft(db, false, func(m gorm.Migrator) error { return m.CreateIndex(model, name) })...)
+		}
+	}
+
+	// the unique columns are indexed by the database without an index of the model
+	uniqueColumns := map[string]bool{}
+	for _, field := range modelSchema.Fields {
+		if field.Unique {
+			uniqueColumns[field.DBName] = true
+		}
+	}
+	for name, index := range live {
+		if _, exist := expectedIndexes[name]; exist {
+			continue
+		}
+		if columns := index.Columns(); len(columns) == 1 && uniqueColumns[columns[0]] {
+			continue
+		}
+
+		table.ExtraIndexes = append(table.ExtraIndexes, name)
+	}
+	sort.Strings(table.ExtraIndexes)
+	for _, name := range table.ExtraIndexes {
+		table.Draft = append(table.Draft, draft(db, true, func(m gorm.Migrator) error { return m.DropIndex(model, name) })...)
+	}
+}
+
+func describeIndex(columns []string, unique bool) string {
+	description := values.BuildStrings("(", strings.Join(columns, ", "), ")")
+	if unique {
+		return "unique " + description
+	}
+
+	return description
+}
+
+func liveTypeOf(columnType gorm.ColumnType) string {
+	if full, ok := columnType.ColumnType(); ok && full != "" {
+		return full
+	}
+
+	return columnType.DatabaseTypeName()
+}
+
+// typeAliases maps the names of the same type to one name, the names differ between the dialect of gorm
+// and the schema reported by the databases.
+var typeAliases = map[string]string{
+	"int":                         "integer",
+	"int4":                        "integer",
+	"serial":                      "integer",
+	"int8":                        "bigint",
+	"bigserial":                   "bigint",
+	"int2":                        "smallint",
+	"smallserial":                 "smallint",
+	"bool":                        "boolean",
+	"character varying":           "varchar",
+	"character":                   "char",
+	"bpchar":                      "char",
+	"numeric":                     "decimal",
+	"float8":                      "double precision",
+	"double":                      "double precision",
+	"float4":                      "real",
+	"timestamptz":                 "timestamp with time zone",
+	"timestamp without time zone": "timestamp",
+}
+
+// normalizeType returns the base name and the size of the type, such as "varchar" and "64" of "VARCHAR(64)".
+func normalizeType(dataType string) (base, size string) {
+	dataType = strings.ToLower(strings.TrimSpace(dataType))
+	if start := strings.Index(dataType, "("); start >= 0 {
+		if end := strings.Index(dataType[start:], ")"); end > 0 {
+			size = strings.ReplaceAll(dataType[start+1:start+end], " ", "")
+			dataType = dataType[:start] + dataType[start+end+1:]
+		}
+	}
+
+	for _, modifier := range []string{" unsigned", " zerofill", " auto_increment"} {
+		dataType = strings.ReplaceAll(dataType, modifier, "")
+	}
+	// sqlite declares the auto increment primary key within the data type
+	if constraint := strings.Index(dataType, " primary key"); constraint >= 0 {
+		dataType = dataType[:constraint]
+	}
+	base = strings.Join(strings.Fields(dataType), " ")
+	if alias, exist := typeAliases[base]; exist {
+		base = alias
+	}
+
+	// mysql stores the booleans as tinyint(1)
+	if base == "tinyint" && size == "1" {
+		return "boolean", ""
+	}
+
+	return base, size
+}
+
+func sameType(expected, actual string) bool {
+	expectedBase, expectedSize := normalizeType(expected)
+	actualBase, actualSize := normalizeType(actual)
+	if expectedBase != actualBase {
+		return false
+	}
+
+	return expectedSize == "" || actualSize == "" || expectedSize == actualSize
+}
+
+// draft captures the sql of the migration executed in the dry run mode, the statements are commented out
+// if destructive is true. The failed migrations are drafted as comments.
+func draft(db *gorm.DB, destructive bool, migrate func(m gorm.Migrator) error) (statements []string) {
+	defer func() {
+		// some migrators read the live rows which are nil in the dry run mode
+		if recovered := recover(); recovered != nil {
+			statements = []string{fmt.Sprint("-- failed to draft the migration: ", recovered)}
+		}
+	}()
+
+	capture := &captureLogger{}
+	dryRun := db.Session(&gorm.Session{DryRun: true, Logger: capture, NewDB: true})
+	if err := migrate(dryRun.Migrator()); err != nil {
+		return []string{values.BuildStrings("-- failed to draft the migration: ", err.Error())}
+	}
+
+	for _, statement := range capture.statements {
+		if destructive {
+			statement = "-- " + statement
+		}
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
@@ -0,0 +1,35 @@
+package drift
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// captureLogger records the statements traced by gorm, it captures the sql built in the dry run mode,
+// the queries reading the schema are not recorded.
+type captureLogger struct {
+	statements []string
+}
+
+func (c *captureLogger) LogMode(logger.LogLevel) logger.Interface {
+	return c
+}
+
+func (c *captureLogger) Info(context.Context, string, ...any) {}
+
+func (c *captureLogger) Warn(context.Context, string, ...any) {}
+
+func (c *captureLogger) Error(context.Context, string, ...any) {}
+
+func (c *captureLogger) Trace(_ context.Context, _ time.Time, fc func() (sql string, rowsAffected int64), _ error) {
+	sql, _ := fc()
+	keyword := strings.ToUpper(strings.TrimSpace(sql))
+	if strings.HasPrefix(keyword, "SELECT") || strings.HasPrefix(keyword, "PRAGMA") {
+		return
+	}
+
+	c.statements = append(c.statements, sql)
+}
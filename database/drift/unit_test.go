@@ -0,0 +1,108 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alioth-center/infrastructure/database"
+	_ "github.com/alioth-center/infrastructure/database/sqlite"
+)
+
+type product struct {
+	ID    int    `gorm:"primaryKey;column:id;autoIncrement"`
+	Name  string `gorm:"column:name;type:varchar(100);index:idx_products_name"`
+	Price int    `gorm:"column:price"`
+	Stock int    `gorm:"column:stock"`
+}
+
+func (product) TableName() string {
+	return "products"
+}
+
+type category struct {
+	ID   int    `gorm:"primaryKey;column:id"`
+	Name string `gorm:"column:name"`
+}
+
+func (category) TableName() string {
+	return "categories"
+}
+
+func TestInspect(t *testing.T) {
+	ctx := context.Background()
+	source := "sqlite://file:drift_test?mode=memory&cache=shared"
+	db, err := database.Open(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the live table misses stock, has the extra legacy column and index, and stores price as text
+	err = db.ExecuteRawSql(ctx, "CREATE TABLE products (id integer PRIMARY KEY AUTOINCREMENT, name varchar(100), price text, legacy text)")
+	if err == nil {
+		err = db.ExecuteRawSql(ctx, "CREATE INDEX idx_products_legacy ON products (legacy)")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Inspect(ctx, db, &product{}, &category{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Tables) != 2 || !report.Tables[1].Missing {
+		t.Fatalf("expected products to drift and categories to be missing, got %+v", report.Tables)
+	}
+
+	products := report.Tables[0]
+	if strings.Join(products.MissingColumns, ",") != "stock" || strings.Join(products.ExtraColumns, ",") != "legacy" {
+		t.Fatalf("unexpected column drift: %+v", products)
+	}
+	if len(products.TypeMismatches) != 1 || products.TypeMismatches[0].Name != "price" {
+		t.Fatalf("unexpected type mismatches: %+v", products.TypeMismatches)
+	}
+	if strings.Join(products.MissingIndexes, ",") != "idx_products_name" || strings.Join(products.ExtraIndexes, ",") != "idx_products_legacy" {
+		t.Fatalf("unexpected index drift: %+v", products)
+	}
+
+	draft := report.MigrationDraft()
+	for _, expected := range []string{"ALTER TABLE `products` ADD `stock`", "CREATE INDEX `idx_products_name`", "-- ALTER TABLE `products` DROP COLUMN `legacy`", "CREATE TABLE `categories`"} {
+		if !strings.Contains(draft, expected) {
+			t.Errorf("expected the draft to contain %q, got:\n%s", expected, draft)
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "migration.sql")
+	command := NewCommand(&product{}, &category{})
+	stdout := &bytes.Buffer{}
+	command.SetOut(stdout)
+	command.SetArgs([]string{"--database", source, "--output", output, "--fail"})
+	command.SilenceUsage, command.SilenceErrors = true, true
+	if err = command.Execute(); !errors.Is(err, ErrSchemaDrift) {
+		t.Fatalf("expected schema drift error, got %v", err)
+	}
+	if written, readErr := os.ReadFile(output); readErr != nil || string(written) != draft {
+		t.Fatalf("expected the draft to be written, got %v", readErr)
+	}
+	if !strings.Contains(stdout.String(), "missing table") {
+		t.Fatalf("unexpected command output: %s", stdout.String())
+	}
+
+	command = NewCommand()
+	command.SetArgs([]string{"--database", source})
+	command.SilenceUsage, command.SilenceErrors = true, true
+	if err = command.Execute(); !errors.Is(err, ErrNoModels) {
+		t.Fatalf("expected no models error, got %v", err)
+	}
+
+	if err = db.GetGormCore(ctx).AutoMigrate(&category{}); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = Inspect(ctx, db, &category{}); err != nil || report.HasDrift() {
+		t.Fatalf("expected no drift after migration, got %v, %v", report, err)
+	}
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/alioth-center/infrastructure/utils/encrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidEncryptionKey   = errors.New("invalid encryption key")
+	ErrUnknownEncryptionKey   = errors.New("unknown encryption key")
+	ErrNoPrimaryEncryptionKey = errors.New("primary encryption key is not set")
+	ErrInvalidEncryptedValue  = errors.New("invalid encrypted value")
+	ErrNoBlindIndexKey        = errors.New("blind index key is not set")
+)
+
+type keyring struct {
+	mu            sync.RWMutex
+	keys          map[string]string
+	primary       string
+	blindIndexKey string
+}
+
+var encryptionKeyring = &keyring{keys: map[string]string{}}
+
+// RegisterEncryptionKey registers the AES key of the id, the key must be 16, 24 or 32 bytes, and the id must
+// not contain colon. The values encrypted by any registered key can be decrypted, so the retired keys should
+// stay registered until all the values are re-encrypted.
+func RegisterEncryptionKey(id, key string) error {
+	if id == "" || strings.Contains(id, ":") {
+		return fmt.Errorf("%w: invalid key id %q", ErrInvalidEncryptionKey, id)
+	}
+	if length := len(key); length != 16 && length != 24 && length != 32 {
+		return fmt.Errorf("%w: key of %s must be 16, 24 or 32 bytes", ErrInvalidEncryptionKey, id)
+	}
+
+	encryptionKeyring.mu.Lock()
+	defer encryptionKeyring.mu.Unlock()
+	encryptionKeyring.keys[id] = key
+	if encryptionKeyring.primary == "" {
+		encryptionKeyring.primary = id
+	}
+
+	return nil
+}
+
+// SetPrimaryEncryptionKey sets the key used to encrypt the new values, the first registered key is
+// the primary key by default.
+func SetPrimaryEncryptionKey(id string) error {
+	encryptionKeyring.mu.Lock()
+	defer encryptionKeyring.mu.Unlock()
+	if _, exist := encryptionKeyring.keys[id]; !exist {
+		return fmt.Errorf("%w: %s", ErrUnknownEncryptionKey, id)
+	}
+
+	encryptionKeyring.primary = id
+	return nil
+}
+
+// SetBlindIndexKey sets the HMAC key of the blind indexes, changing it invalidates all the existing indexes.
+func SetBlindIndexKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty blind index key", ErrInvalidEncryptionKey)
+	}
+
+	encryptionKeyring.mu.Lock()
+	defer encryptionKeyring.mu.Unlock()
+	encryptionKeyring.blindIndexKey = key
+	return nil
+}
+
+func (k *keyring) encrypt(plain string) (string, error) {
+	k.mu.RLock()
+	id, key := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+	if id == "" {
+		return "", ErrNoPrimaryEncryptionKey
+	}
+
+	encrypted, err := encrypt.AesGcmEncrypt(plain, key)
+	if err != nil {
+		return "", err
+	}
+
+	return id + ":" + encrypted, nil
+}
+
+func (k *keyring) decrypt(stored string) (plain, id string, err error) {
+	id, encrypted, found := strings.Cut(stored, ":")
+	if !found {
+		return "", "", ErrInvalidEncryptedValue
+	}
+
+	k.mu.RLock()
+	key, exist := k.keys[id]
+	k.mu.RUnlock()
+	if !exist {
+		return "", id, fmt.Errorf("%w: %s", ErrUnknownEncryptionKey, id)
+	}
+
+	plain, err = encrypt.AesGcmDecrypt(encrypted, key)
+	if err != nil {
+		return "", id, fmt.Errorf("%w: %w", ErrInvalidEncryptedValue, err)
+	}
+
+	return plain, id, nil
+}
+
+// EncryptedString is a string stored encrypted by AES-GCM, it is stored as "keyID:base64(nonce+ciphertext)"
+// with the primary key, and decrypted by the key of the stored id when scanned. The empty string is stored
+// as it is. The encryption is randomized, so the column cannot be used in conditions, use BlindIndex instead.
+//
+// example:
+//
+//	_ = database.RegisterEncryptionKey("2024-01", os.Getenv("PHONE_KEY"))
+//
+//	type User struct {
+//		ID         int                      `gorm:"column:id;primaryKey"`
+//		Phone      database.EncryptedString `gorm:"column:phone;type:varchar(255)"`
+//		PhoneIndex database.BlindIndex      `gorm:"column:phone_index;type:varchar(80);index"`
+//	}
+type EncryptedString string
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	return encryptionKeyring.encrypt(string(s))
+}
+
+func (s *EncryptedString) Scan(src any) error {
+	var stored string
+	switch value := src.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		stored = value
+	case []byte:
+		stored = string(value)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidEncryptedValue, src)
+	}
+
+	if stored == "" {
+		*s = ""
+		return nil
+	}
+
+	plain, _, err := encryptionKeyring.decrypt(stored)
+	if err != nil {
+		return err
+	}
+
+	*s = EncryptedString(plain)
+	return nil
+}
+
+// String returns the plain text, it makes the value printable as a normal string.
+func (s EncryptedString) String() string {
+	return string(s)
+}
+
+const blindIndexPrefix = "bi:"
+
+// BlindIndex is the deterministic HMAC-SHA256 digest of a plain text, it is set to the plain text and
+// stored as the digest, so the equality lookups can be done by the blind index of the value:
+//
+//	err := db.GetDataBySingleCondition(ctx, &user, "phone_index", database.BlindIndex("13800000000"))
+//
+// The scanned value is the stored digest, which is stored as it is when saved again.
+type BlindIndex string
+
+func (b BlindIndex) Value() (driver.Value, error) {
+	if b == "" {
+		return "", nil
+	}
+	if isBlindIndexDigest(string(b)) {
+		return string(b), nil
+	}
+
+	encryptionKeyring.mu.RLock()
+	key := encryptionKeyring.blindIndexKey
+	encryptionKeyring.mu.RUnlock()
+	if key == "" {
+		return nil, ErrNoBlindIndexKey
+	}
+
+	return blindIndexPrefix + encrypt.HmacSHA256(string(b), key), nil
+}
+
+func (b *BlindIndex) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*b = ""
+	case string:
+		*b = BlindIndex(value)
+	case []byte:
+		*b = BlindIndex(value)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidEncryptedValue, src)
+	}
+
+	return nil
+}
+
+func isBlindIndexDigest(value string) bool {
+	if len(value) != len(blindIndexPrefix)+64 || !strings.HasPrefix(value, blindIndexPrefix) {
+		return false
+	}
+
+	for _, c := range value[len(blindIndexPrefix):] {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ReEncryptColumns re-encrypts the EncryptedString columns of the model with the primary key, it walks the
+// table by the primary key in batches and only updates the values encrypted by other keys, so it can be
+// resumed after a failure. The model must have a single primary key.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for the database operation.
+//	db (DatabaseV2): The database to operate.
+//	model (any): The model of the table, such as &User{}.
+//	batchSize (int): The rows read in a batch, default is 500.
+//	columns (...string): The encrypted columns to re-encrypt.
+//
+// Returns:
+//
+//	updated (int64): The number of re-encrypted values.
+//	err (error): An error if the operation fails, otherwise nil.
+func ReEncryptColumns(ctx context.Context, db DatabaseV2, model any, batchSize int, columns ...string) (updated int64, err error) {
+	if len(columns) == 0 {
+		return 0, ErrInvalidCondition
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	core := db.GetGormCore(ctx)
+	stmt := &gorm.Statement{DB: core}
+	if parseErr := stmt.Parse(model); parseErr != nil {
+		return 0, parseErr
+	}
+	if len(stmt.Schema.PrimaryFieldDBNames) != 1 {
+		return 0, fmt.Errorf("%w: model must have a single primary key", ErrInvalidCondition)
+	}
+
+	encryptionKeyring.mu.RLock()
+	primary := encryptionKeyring.primary
+	encryptionKeyring.mu.RUnlock()
+	if primary == "" {
+		return 0, ErrNoPrimaryEncryptionKey
+	}
+
+	primaryKey := stmt.Schema.PrimaryFieldDBNames[0]
+	primaryColumn := clause.Column{Table: clause.CurrentTable, Name: primaryKey}
+	var lastKey any
+	for {
+		var rows []map[string]any
+		// the table is queried without the model, so the values are not decrypted by the scanner
+		query := core.Table(stmt.Table).Select(append([]string{primaryKey}, columns...)).Order(clause.OrderByColumn{Column: primaryColumn}).Limit(batchSize)
+		if lastKey != nil {
+			query = query.Where(clause.Gt{Column: primaryColumn, Value: lastKey})
+		}
+		if findErr := query.Find(&rows).Error; findErr != nil {
+			return updated, ClassifyError(findErr)
+		}
+
+		for _, row := range rows {
+			changes := map[string]any{}
+			for _, column := range columns {
+				stored := fmt.Sprint(row[column])
+				if raw, isBytes := row[column].([]byte); isBytes {
+					stored = string(raw)
+				}
+				if row[column] == nil || stored == "" || strings.HasPrefix(stored, primary+":") {
+					continue
+				}
+
+				plain, _, decryptErr := encryptionKeyring.decrypt(stored)
+				if decryptErr != nil {
+					return updated, fmt.Errorf("decrypt %s of %v error: %w", column, row[primaryKey], decryptErr)
+				}
+				changes[column] = EncryptedString(plain)
+			}
+
+			if len(changes) > 0 {
+				updateErr := core.Model(model).Where(clause.Eq{Column: primaryColumn, Value: row[primaryKey]}).UpdateColumns(changes).Error
+				if updateErr != nil {
+					return updated, ClassifyError(updateErr)
+				}
+				updated += int64(len(changes))
+			}
+		}
+
+		if len(rows) < batchSize {
+			return updated, nil
+		}
+		lastKey = rows[len(rows)-1][primaryKey]
+	}
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+var exportSchemas = &sync.Map{}
+
+// ExportCSV writes the rows into the writer as csv, the header is the column names of the model T named by the
+// default gorm naming strategy, it works with StreamData to export the large tables.
+//
+// Parameters:
+//
+//	w (io.Writer): The writer of the csv.
+//	rows (iter.Seq2[T, error]): The rows to export, such as the iterator returned by StreamData.
+//	columns (...string): The columns to export in order, all columns of the model are exported if absent.
+//
+// Returns:
+//
+//	exported (int): The count of the exported rows.
+//	err (error): The error of the rows or the writer.
+//
+// example:
+//
+//	exported, err := database.ExportCSV(file, database.StreamData[User](ctx, db, condition), "id", "name", "email")
+func ExportCSV[T any](w io.Writer, rows iter.Seq2[T, error], columns ...string) (exported int, err error) {
+	modelSchema, parseErr := schema.Parse(new(T), exportSchemas, schema.NamingStrategy{})
+	if parseErr != nil {
+		return 0, fmt.Errorf("parse model schema error: %w", parseErr)
+	}
+
+	fields := make([]*schema.Field, 0, len(columns))
+	if len(columns) == 0 {
+		for _, field := range modelSchema.Fields {
+			if field.DBName != "" {
+				fields = append(fields, field)
+				columns = append(columns, field.DBName)
+			}
+		}
+	} else {
+		for _, column := range columns {
+			field := modelSchema.LookUpField(column)
+			if field == nil || field.DBName == "" {
+				return 0, fmt.Errorf("column %s not found in %s", column, modelSchema.Name)
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if err = writer.Write(columns); err != nil {
+		return 0, err
+	}
+
+	record := make([]string, len(fields))
+	for row, rowErr := range rows {
+		if rowErr != nil {
+			writer.Flush()
+			return exported, rowErr
+		}
+
+		value := reflect.ValueOf(&row).Elem()
+		for i, field := range fields {
+			fieldValue, _ := field.ValueOf(context.Background(), value)
+			if record[i], err = formatCSVValue(fieldValue); err != nil {
+				writer.Flush()
+				return exported, fmt.Errorf("format column %s error: %w", field.DBName, err)
+			}
+		}
+		if err = writer.Write(record); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+
+	writer.Flush()
+	return exported, writer.Error()
+}
+
+// ExportJSONLines writes the rows into the writer as json lines, every row is encoded by encoding/json in a
+// line, it works with StreamData to export the large tables.
+//
+// Parameters:
+//
+//	w (io.Writer): The writer of the json lines.
+//	rows (iter.Seq2[T, error]): The rows to export, such as the iterator returned by StreamData.
+//
+// Returns:
+//
+//	exported (int): The count of the exported rows.
+//	err (error): The error of the rows, the encoding or the writer.
+//
+// example:
+//
+//	exported, err := database.ExportJSONLines(file, database.StreamData[User](ctx, db, condition))
+func ExportJSONLines[T any](w io.Writer, rows iter.Seq2[T, error]) (exported int, err error) {
+	encoder := json.NewEncoder(w)
+	for row, rowErr := range rows {
+		if rowErr != nil {
+			return exported, rowErr
+		}
+
+		if err = encoder.Encode(row); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+
+	return exported, nil
+}
+
+func formatCSVValue(value any) (string, error) {
+	reflected := reflect.ValueOf(value)
+	for reflected.Kind() == reflect.Pointer {
+		if reflected.IsNil() {
+			return "", nil
+		}
+		reflected = reflected.Elem()
+	}
+	if !reflected.IsValid() {
+		return "", nil
+	}
+
+	switch typed := reflected.Interface().(type) {
+	case []byte:
+		return string(typed), nil
+	case time.Time:
+		return typed.Format(time.RFC3339Nano), nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	}
+	// the string kinds are written as they are, so the EncryptedString and BlindIndex are exported as the plain
+	// text like the ExportJSONLines, instead of the ciphertext or the digest stored in the database.
+	if reflected.Kind() == reflect.String {
+		return reflected.String(), nil
+	}
+
+	switch typed := value.(type) {
+	case encoding.TextMarshaler:
+		text, err := typed.MarshalText()
+		return string(text), err
+	case fmt.Stringer:
+		return typed.String(), nil
+	case driver.Valuer:
+		converted, err := typed.Value()
+		if err != nil {
+			return "", err
+		}
+		return formatCSVValue(converted)
+	default:
+		return fmt.Sprint(reflected.Interface()), nil
+	}
+}
@@ -0,0 +1,394 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/alioth-center/infrastructure/database"
+	"github.com/alioth-center/infrastructure/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	ExtensionName    = "audit"
+	DefaultTableName = "audit_records"
+
+	beforeRowsKey = "audit:before_rows"
+)
+
+type Option func(a *Auditor)
+
+// WithTableNameOpts sets the table name of the audit records, default is DefaultTableName.
+func WithTableNameOpts(table string) Option {
+	return func(a *Auditor) {
+		if table != "" {
+			a.table = table
+		}
+	}
+}
+
+// WithAuditTablesOpts limits the audit to the given tables, all tables are audited by default.
+func WithAuditTablesOpts(tables ...string) Option {
+	return func(a *Auditor) {
+		for _, table := range tables {
+			a.tables[table] = true
+		}
+	}
+}
+
+// WithActorColumnsOpts sets the columns filled with the actor on create and update,
+// default is created_by and updated_by, empty column name disables the filling.
+func WithActorColumnsOpts(createdBy, updatedBy string) Option {
+	return func(a *Auditor) {
+		a.createdBy, a.updatedBy = createdBy, updatedBy
+	}
+}
+
+// Auditor records the before and after values of create, update and delete operations into
+// the audit table, the records are written in the same transaction as the operations.
+type Auditor struct {
+	db        database.DatabaseV2
+	table     string
+	tables    map[string]bool
+	createdBy string
+	updatedBy string
+}
+
+// Register migrates the audit table and registers the audit callbacks on the database, the callbacks
+// take effect on all operations executed by gorm with a parsed model, raw sql is not audited.
+//
+// example:
+//
+//	auditor, err := audit.Register(db, audit.WithAuditTablesOpts("users"))
+//	ctx = audit.WithActor(ctx, "admin")
+//	err = db.UpdateDataBySingleCondition(ctx, &User{Age: 26}, "name", "Alice")
+//	records, err := auditor.GetHistory(ctx, "users", "1", 0, 10)
+func Register(db database.DatabaseV2, opts ...Option) (auditor *Auditor, err error) {
+	auditor = &Auditor{
+		db:        db,
+		table:     DefaultTableName,
+		tables:    map[string]bool{},
+		createdBy: "created_by",
+		updatedBy: "updated_by",
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(auditor)
+		}
+	}
+
+	core := db.GetGormCore(context.Background())
+	if migrateErr := core.Table(auditor.table).AutoMigrate(&Record{}); migrateErr != nil {
+		return nil, fmt.Errorf("migrate audit table error: %w", migrateErr)
+	}
+
+	callbacks := core.Callback()
+	registers := []error{
+		callbacks.Create().Before("gorm:create").Register("audit:before_create", auditor.beforeCreate),
+		callbacks.Create().After("gorm:create").Register("audit:after_create", auditor.afterCreate),
+		callbacks.Update().Before("gorm:update").Register("audit:before_update", auditor.beforeUpdate),
+		callbacks.Update().After("gorm:update").Register("audit:after_update", auditor.afterUpdate),
+		callbacks.Delete().Before("gorm:delete").Register("audit:before_delete", auditor.beforeDelete),
+		callbacks.Delete().After("gorm:delete").Register("audit:after_delete", auditor.afterDelete),
+	}
+	for _, registerErr := range registers {
+		if registerErr != nil {
+			return nil, fmt.Errorf("register audit callback error: %w", registerErr)
+		}
+	}
+
+	return auditor, nil
+}
+
+func (a *Auditor) ExtensionName() string {
+	return ExtensionName
+}
+
+// GetHistory retrieves the audit records of a row, ordered from the newest to the oldest.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for the database operation.
+//	table (string): The table name of the audited row.
+//	primaryKey (string): The primary key of the audited row, composite keys are joined by comma.
+//	offset (int): The offset for pagination.
+//	limit (int): The limit for pagination.
+//
+// Returns:
+//
+//	records ([]Record): The audit records of the row.
+//	err (error): An error if the operation fails, otherwise nil.
+func (a *Auditor) GetHistory(ctx context.Context, table, primaryKey string, offset, limit int) (records []Record, err error) {
+	err = a.db.GetGormCore(ctx).Table(a.table).
+		Where("table_name = ? AND primary_key = ?", table, primaryKey).
+		Order("id desc").Offset(offset * limit).Limit(limit).
+		Find(&records).Error
+	return records, err
+}
+
+func (a *Auditor) audited(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return false
+	}
+
+	table := db.Statement.Table
+	if table == a.table {
+		return false
+	}
+
+	return len(a.tables) == 0 || a.tables[table]
+}
+
+func (a *Auditor) beforeCreate(db *gorm.DB) {
+	if !a.audited(db) {
+		return
+	}
+
+	if actor := ActorFromContext(db.Statement.Context); actor != "" {
+		for _, column := range []string{a.createdBy, a.updatedBy} {
+			if column != "" && db.Statement.Schema.LookUpField(column) != nil {
+				db.Statement.SetColumn(column, actor, true)
+			}
+		}
+	}
+}
+
+func (a *Auditor) afterCreate(db *gorm.DB) {
+	if !a.audited(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	var rows []map[string]any
+	switch value := reflect.Indirect(db.Statement.ReflectValue); value.Kind() {
+	case reflect.Struct:
+		rows = append(rows, modelToMap(db, value))
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			rows = append(rows, modelToMap(db, reflect.Indirect(value.Index(i))))
+		}
+	default:
+		return
+	}
+
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, a.buildRecord(db, ActionCreate, nil, row))
+	}
+	a.writeRecords(db, records)
+}
+
+func (a *Auditor) beforeUpdate(db *gorm.DB) {
+	if !a.audited(db) {
+		return
+	}
+
+	if actor := ActorFromContext(db.Statement.Context); actor != "" && a.updatedBy != "" && db.Statement.Schema.LookUpField(a.updatedBy) != nil {
+		db.Statement.SetColumn(a.updatedBy, actor, true)
+	}
+
+	a.loadBeforeRows(db)
+}
+
+func (a *Auditor) afterUpdate(db *gorm.DB) {
+	if !a.audited(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	beforeRows := a.beforeRows(db)
+	afterRows := map[string]map[string]any{}
+	if primaryFields := db.Statement.Schema.PrimaryFieldDBNames; len(primaryFields) > 0 && len(beforeRows) > 0 {
+		var rows []map[string]any
+		query := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Unscoped().Model(reflect.New(db.Statement.Schema.ModelType).Interface())
+		if db.Statement.Table != "" {
+			query = query.Table(db.Statement.Table)
+		}
+
+		primaryValues := make([][]any, 0, len(beforeRows))
+		for _, row := range beforeRows {
+			values := make([]any, len(primaryFields))
+			for i, field := range primaryFields {
+				values[i] = row[field]
+			}
+			primaryValues = append(primaryValues, values)
+		}
+		column, queryValues := schema.ToQueryValues(clause.CurrentTable, primaryFields, primaryValues)
+		if err := query.Clauses(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: queryValues}}}).Find(&rows).Error; err != nil {
+			_ = db.AddError(fmt.Errorf("load audit after rows error: %w", err))
+			return
+		}
+		for _, row := range rows {
+			afterRows[primaryKeyOf(db, normalizeRow(row))] = normalizeRow(row)
+		}
+	}
+
+	records := make([]Record, 0, len(beforeRows))
+	for _, before := range beforeRows {
+		records = append(records, a.buildRecord(db, ActionUpdate, before, afterRows[primaryKeyOf(db, before)]))
+	}
+	a.writeRecords(db, records)
+}
+
+func (a *Auditor) beforeDelete(db *gorm.DB) {
+	if !a.audited(db) {
+		return
+	}
+
+	a.loadBeforeRows(db)
+}
+
+func (a *Auditor) afterDelete(db *gorm.DB) {
+	if !a.audited(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	beforeRows := a.beforeRows(db)
+	records := make([]Record, 0, len(beforeRows))
+	for _, before := range beforeRows {
+		records = append(records, a.buildRecord(db, ActionDelete, before, nil))
+	}
+	a.writeRecords(db, records)
+}
+
+func (a *Auditor) loadBeforeRows(db *gorm.DB) {
+	var rows []map[string]any
+	if err := database.LoadAffectedRows(db, &rows); err != nil {
+		_ = db.AddError(fmt.Errorf("load audit before rows error: %w", err))
+		return
+	}
+
+	for i := range rows {
+		rows[i] = normalizeRow(rows[i])
+	}
+	db.InstanceSet(beforeRowsKey, rows)
+}
+
+func (a *Auditor) beforeRows(db *gorm.DB) []map[string]any {
+	value, exist := db.InstanceGet(beforeRowsKey)
+	if !exist {
+		return nil
+	}
+
+	rows, _ := value.([]map[string]any)
+	return rows
+}
+
+func (a *Auditor) buildRecord(db *gorm.DB, action string, before, after map[string]any) Record {
+	ctx := db.Statement.Context
+	record := Record{
+		Table:   db.Statement.Table,
+		Action:  action,
+		Actor:   ActorFromContext(ctx),
+		TraceID: trace.GetTid(ctx),
+		Before:  marshal(before),
+		After:   marshal(after),
+		Changes: marshal(diff(before, after)),
+	}
+
+	if before != nil {
+		record.PrimaryKey = primaryKeyOf(db, before)
+	} else {
+		record.PrimaryKey = primaryKeyOf(db, after)
+	}
+
+	return record
+}
+
+func (a *Auditor) writeRecords(db *gorm.DB, records []Record) {
+	if len(records) == 0 {
+		return
+	}
+
+	writer := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table(a.table)
+	if err := writer.Create(&records).Error; err != nil {
+		_ = db.AddError(fmt.Errorf("write audit records error: %w", err))
+	}
+}
+
+func modelToMap(db *gorm.DB, value reflect.Value) map[string]any {
+	row := make(map[string]any, len(db.Statement.Schema.DBNames))
+	for _, column := range db.Statement.Schema.DBNames {
+		field := db.Statement.Schema.FieldsByDBName[column]
+		fieldValue, _ := field.ValueOf(db.Statement.Context, value)
+		row[column] = fieldValue
+	}
+
+	return normalizeRow(row)
+}
+
+func normalizeRow(row map[string]any) map[string]any {
+	for key, value := range row {
+		switch v := value.(type) {
+		case []byte:
+			row[key] = string(v)
+		case *time.Time:
+			if v == nil {
+				row[key] = nil
+			} else {
+				row[key] = *v
+			}
+		case gorm.DeletedAt:
+			if v.Valid {
+				row[key] = v.Time
+			} else {
+				row[key] = nil
+			}
+		}
+	}
+
+	return row
+}
+
+func primaryKeyOf(db *gorm.DB, row map[string]any) string {
+	if row == nil {
+		return ""
+	}
+
+	keys := make([]string, 0, len(db.Statement.Schema.PrimaryFieldDBNames))
+	for _, column := range db.Statement.Schema.PrimaryFieldDBNames {
+		keys = append(keys, fmt.Sprint(row[column]))
+	}
+
+	return strings.Join(keys, ",")
+}
+
+func diff(before, after map[string]any) map[string]any {
+	changes := map[string]any{}
+	for column, afterValue := range after {
+		beforeValue, exist := before[column]
+		if !exist || !sameValue(beforeValue, afterValue) {
+			changes[column] = map[string]any{"before": beforeValue, "after": afterValue}
+		}
+	}
+	for column, beforeValue := range before {
+		if _, exist := after[column]; !exist && after != nil {
+			changes[column] = map[string]any{"before": beforeValue, "after": nil}
+		}
+	}
+
+	return changes
+}
+
+func sameValue(a, b any) bool {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Equal(tb)
+		}
+	}
+
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func marshal(value map[string]any) string {
+	if value == nil {
+		return ""
+	}
+
+	bytes, _ := json.Marshal(value)
+	return string(bytes)
+}
@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Record is a row of the audit table, Before, After and Changes are json encoded column maps.
+type Record struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Table      string    `gorm:"column:table_name;type:varchar(128);index:idx_audit_target" json:"table_name"`
+	PrimaryKey string    `gorm:"column:primary_key;type:varchar(255);index:idx_audit_target" json:"primary_key"`
+	Action     string    `gorm:"column:action;type:varchar(16)" json:"action"`
+	Actor      string    `gorm:"column:actor;type:varchar(128)" json:"actor"`
+	TraceID    string    `gorm:"column:trace_id;type:varchar(64)" json:"trace_id"`
+	Before     string    `gorm:"column:before_value;type:text" json:"before_value"`
+	After      string    `gorm:"column:after_value;type:text" json:"after_value"`
+	Changes    string    `gorm:"column:changes;type:text" json:"changes"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (Record) TableName() string {
+	return DefaultTableName
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context carrying the actor of the database operations, the actor is
+// written into the audit records and the created_by/updated_by columns.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor carried by the context, returns empty string if not set.
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return actor
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alioth-center/infrastructure/database"
+	"github.com/alioth-center/infrastructure/database/sqlite"
+	"github.com/alioth-center/infrastructure/logger"
+	"github.com/alioth-center/infrastructure/trace"
+	"gorm.io/gorm"
+)
+
+type account struct {
+	ID        int    `gorm:"primaryKey;column:id;autoIncrement"`
+	Name      string `gorm:"column:name"`
+	Balance   int    `gorm:"column:balance"`
+	CreatedBy string `gorm:"column:created_by"`
+	UpdatedBy string `gorm:"column:updated_by"`
+	DeletedAt gorm.DeletedAt
+}
+
+func (account) TableName() string {
+	return "accounts"
+}
+
+func TestAuditor(t *testing.T) {
+	db, err := sqlite.NewWithLogger(sqlite.Config{Database: "file:audit_test?mode=memory&cache=shared"}, logger.Mute(), &account{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditor, err := Register(db, WithAuditTablesOpts("accounts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithActor(trace.NewContext(), "alice")
+	created := &account{Name: "acc", Balance: 100}
+	if _, err = db.CreateSingleDataIfNotExist(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+	if created.CreatedBy != "alice" || created.UpdatedBy != "alice" {
+		t.Fatalf("expected actor columns to be filled, got %+v", created)
+	}
+
+	ctx = WithActor(trace.NewContext(), "bob")
+	if err = db.UpdateDataBySingleCondition(ctx, &account{Balance: 50}, "name", "acc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.SoftDeleteData(ctx, &account{}, map[string]any{"name": "acc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := auditor.GetHistory(ctx, "accounts", "1", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 audit records, got %d", len(records))
+	}
+	if records[0].Action != ActionDelete || records[1].Action != ActionUpdate || records[2].Action != ActionCreate {
+		t.Fatalf("unexpected audit actions: %s, %s, %s", records[0].Action, records[1].Action, records[2].Action)
+	}
+
+	if records[0].Before == "" || records[2].After == "" {
+		t.Fatalf("expected before value of delete and after value of create to be recorded")
+	}
+
+	update := records[1]
+	if update.Actor != "bob" || update.TraceID != trace.GetTid(ctx) {
+		t.Fatalf("unexpected actor or trace id: %+v", update)
+	}
+
+	changes := map[string]map[string]any{}
+	if err = json.Unmarshal([]byte(update.Changes), &changes); err != nil {
+		t.Fatal(err)
+	}
+	if changes["balance"]["before"] != float64(100) || changes["balance"]["after"] != float64(50) {
+		t.Fatalf("unexpected balance changes: %v", changes["balance"])
+	}
+	if changes["updated_by"]["after"] != "bob" {
+		t.Fatalf("unexpected updated_by changes: %v", changes["updated_by"])
+	}
+	if _, exist := changes["name"]; exist {
+		t.Fatalf("unchanged column should not be recorded: %v", changes)
+	}
+
+	var accounts []account
+	if err = db.GetDataByCustomCondition(ctx, &accounts, map[string]any{"name": "acc"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 0 {
+		t.Fatalf("expected soft deleted account to be hidden, got %d", len(accounts))
+	}
+	if err = db.ListDataWithDeleted(ctx, &accounts, map[string]any{"name": "acc"}, "id", false, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 {
+		t.Fatalf("expected soft deleted account to be listed, got %d", len(accounts))
+	}
+
+	if err = db.RestoreData(ctx, &account{}, map[string]any{"name": "acc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.GetDataByCustomCondition(ctx, &accounts, map[string]any{"name": "acc"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 {
+		t.Fatalf("expected restored account to be visible, got %d", len(accounts))
+	}
+
+	type plain struct {
+		ID int
+	}
+	if err = db.SoftDeleteData(ctx, &plain{}, map[string]any{"id": 1}); err != database.ErrSoftDeleteUnsupported {
+		t.Fatalf("expected soft delete unsupported error, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package tenancy
+
+import "context"
+
+type tenantContextKey struct{}
+
+type unscopedContextKey struct{}
+
+// WithTenant returns a context carrying the tenant id, the operations executed with the
+// context are scoped to the tenant.
+func WithTenant(ctx context.Context, tenantID any) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant id carried by the context, ok is false if not set.
+func TenantFromContext(ctx context.Context) (tenantID any, ok bool) {
+	if ctx == nil {
+		return nil, false
+	}
+
+	tenantID = ctx.Value(tenantContextKey{})
+	return tenantID, tenantID != nil
+}
+
+// WithoutTenant returns a context which skips the tenant scoping, it is the escape hatch for
+// the admin jobs operating on all tenants, use it explicitly and carefully.
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedContextKey{}, true)
+}
+
+// IsUnscoped reports whether the context skips the tenant scoping.
+func IsUnscoped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	unscoped, _ := ctx.Value(unscopedContextKey{}).(bool)
+	return unscoped
+}
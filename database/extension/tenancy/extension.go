@@ -0,0 +1,294 @@
+// Package tenancy scopes the database operations to the tenant carried by the context, the tenant is
+// isolated by a tenant column on the tables, or by a schema per tenant on postgres.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/alioth-center/infrastructure/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	ExtensionName     = "tenancy"
+	DefaultColumnName = "tenant_id"
+)
+
+var (
+	ErrMissingTenant              = errors.New("tenant is not set in the context")
+	ErrCrossTenantWrite           = errors.New("writing the data of another tenant")
+	ErrSchemaPerTenantUnsupported = errors.New("schema per tenant is only supported by postgres")
+)
+
+type Option func(t *Tenancy)
+
+// WithColumnOpts sets the tenant column, default is DefaultColumnName. The tables having
+// the column are scoped, the others are not affected.
+func WithColumnOpts(column string) Option {
+	return func(t *Tenancy) {
+		if column != "" {
+			t.column = column
+		}
+	}
+}
+
+// WithExcludedTablesOpts excludes the tables from the tenant scoping, such as the shared dictionary tables.
+func WithExcludedTablesOpts(tables ...string) Option {
+	return func(t *Tenancy) {
+		for _, table := range tables {
+			t.excluded[table] = true
+		}
+	}
+}
+
+// WithAllowMissingTenantOpts allows the operations on the scoped tables without the tenant in the context,
+// they are not scoped. By default, such operations fail with ErrMissingTenant.
+func WithAllowMissingTenantOpts() Option {
+	return func(t *Tenancy) {
+		t.allowMissing = true
+	}
+}
+
+// WithSchemaPerTenantOpts isolates the tenants by schemas instead of the tenant column, the tables are
+// qualified with the schema named by naming, default naming is "tenant_" + tenant id. It is postgres only.
+func WithSchemaPerTenantOpts(naming func(tenantID any) string) Option {
+	return func(t *Tenancy) {
+		t.schemaPerTenant = true
+		if naming != nil {
+			t.schemaNaming = naming
+		}
+	}
+}
+
+// Tenancy injects the tenant of the context into the queries, creates, updates and deletes executed by gorm
+// with a parsed model. Raw sql is never scoped, filter it by the tenant manually.
+type Tenancy struct {
+	db              database.DatabaseV2
+	column          string
+	excluded        map[string]bool
+	allowMissing    bool
+	schemaPerTenant bool
+	schemaNaming    func(tenantID any) string
+}
+
+// Register registers the tenancy callbacks on the database.
+//
+// example:
+//
+//	_, err := tenancy.Register(db)
+//	ctx = tenancy.WithTenant(ctx, "tenant-a")
+//	err = db.ListDataWithPage(ctx, &users, map[string]any{"status": 1}, "id", false, 0, 10)
+//	// SELECT * FROM users WHERE status = 1 AND users.tenant_id = 'tenant-a' ...
+func Register(db database.DatabaseV2, opts ...Option) (tenancy *Tenancy, err error) {
+	tenancy = &Tenancy{
+		db:       db,
+		column:   DefaultColumnName,
+		excluded: map[string]bool{},
+		schemaNaming: func(tenantID any) string {
+			return fmt.Sprint("tenant_", tenantID)
+		},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(tenancy)
+		}
+	}
+
+	core := db.GetGormCore(context.Background())
+	if tenancy.schemaPerTenant && core.Dialector.Name() != "postgres" {
+		return nil, ErrSchemaPerTenantUnsupported
+	}
+
+	callbacks := core.Callback()
+	registers := []error{
+		callbacks.Query().Before("gorm:query").Register("tenancy:query", tenancy.scopeQuery),
+		callbacks.Row().Before("gorm:row").Register("tenancy:row", tenancy.scopeQuery),
+		callbacks.Create().Before("gorm:create").Register("tenancy:create", tenancy.scopeCreate),
+		callbacks.Update().Before("gorm:update").Register("tenancy:update", tenancy.scopeUpdate),
+		callbacks.Delete().Before("gorm:delete").Register("tenancy:delete", tenancy.scopeQuery),
+	}
+	for _, registerErr := range registers {
+		if registerErr != nil {
+			return nil, fmt.Errorf("register tenancy callback error: %w", registerErr)
+		}
+	}
+
+	return tenancy, nil
+}
+
+func (t *Tenancy) ExtensionName() string {
+	return ExtensionName
+}
+
+// MigrateTenant creates the schema of the tenant and migrates the models into it, it is only
+// available with WithSchemaPerTenantOpts.
+func (t *Tenancy) MigrateTenant(ctx context.Context, tenantID any, models ...any) error {
+	if !t.schemaPerTenant {
+		return ErrSchemaPerTenantUnsupported
+	}
+
+	tenantSchema := t.schemaNaming(tenantID)
+	core := t.db.GetGormCore(WithoutTenant(ctx))
+	if err := core.Exec("CREATE SCHEMA IF NOT EXISTS ?", clause.Table{Name: tenantSchema}).Error; err != nil {
+		return fmt.Errorf("create tenant schema %s error: %w", tenantSchema, err)
+	}
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: core}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("parse tenant model error: %w", err)
+		}
+
+		if err := core.Table(tenantSchema + "." + stmt.Schema.Table).AutoMigrate(model); err != nil {
+			return fmt.Errorf("migrate tenant table %s.%s error: %w", tenantSchema, stmt.Schema.Table, err)
+		}
+	}
+
+	return nil
+}
+
+// tenant returns the tenant of the statement, scoped is false if the statement should not be scoped.
+func (t *Tenancy) tenant(db *gorm.DB) (tenantID any, scoped bool) {
+	if db.Error != nil || db.Statement.Table == "" || t.excluded[db.Statement.Table] {
+		return nil, false
+	}
+	if !t.schemaPerTenant && (db.Statement.Schema == nil || db.Statement.Schema.LookUpField(t.column) == nil) {
+		return nil, false
+	}
+	if IsUnscoped(db.Statement.Context) {
+		return nil, false
+	}
+
+	tenantID, exist := TenantFromContext(db.Statement.Context)
+	if !exist {
+		if !t.allowMissing {
+			_ = db.AddError(fmt.Errorf("%w: table %s", ErrMissingTenant, db.Statement.Table))
+		}
+		return nil, false
+	}
+
+	return tenantID, true
+}
+
+// scope qualifies the table with the tenant schema, or adds the tenant condition.
+func (t *Tenancy) scope(db *gorm.DB, tenantID any) {
+	if t.schemaPerTenant {
+		if !strings.Contains(db.Statement.Table, ".") {
+			db.Statement.Table = t.schemaNaming(tenantID) + "." + db.Statement.Table
+		}
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: t.column}, Value: tenantID},
+	}})
+}
+
+func (t *Tenancy) scopeQuery(db *gorm.DB) {
+	if tenantID, scoped := t.tenant(db); scoped {
+		t.scope(db, tenantID)
+	}
+}
+
+func (t *Tenancy) scopeCreate(db *gorm.DB) {
+	tenantID, scoped := t.tenant(db)
+	if !scoped {
+		return
+	}
+
+	if t.schemaPerTenant {
+		t.scope(db, tenantID)
+		return
+	}
+
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]any:
+		t.fillMap(db, dest, tenantID)
+	case *map[string]any:
+		t.fillMap(db, *dest, tenantID)
+	case []map[string]any:
+		for _, row := range dest {
+			t.fillMap(db, row, tenantID)
+		}
+	case *[]map[string]any:
+		for _, row := range *dest {
+			t.fillMap(db, row, tenantID)
+		}
+	default:
+		field := db.Statement.Schema.LookUpField(t.column)
+		switch value := reflect.Indirect(db.Statement.ReflectValue); value.Kind() {
+		case reflect.Struct:
+			t.fillField(db, field, value, tenantID)
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < value.Len(); i++ {
+				t.fillField(db, field, reflect.Indirect(value.Index(i)), tenantID)
+			}
+		}
+	}
+}
+
+func (t *Tenancy) fillMap(db *gorm.DB, row map[string]any, tenantID any) {
+	field := db.Statement.Schema.LookUpField(t.column)
+	for _, key := range []string{field.DBName, field.Name} {
+		if value, exist := row[key]; exist && value != nil {
+			if !sameTenant(value, tenantID) {
+				_ = db.AddError(fmt.Errorf("%w: %v", ErrCrossTenantWrite, value))
+			}
+			return
+		}
+	}
+
+	row[field.DBName] = tenantID
+}
+
+func (t *Tenancy) fillField(db *gorm.DB, field *schema.Field, value reflect.Value, tenantID any) {
+	current, isZero := field.ValueOf(db.Statement.Context, value)
+	if !isZero {
+		if !sameTenant(current, tenantID) {
+			_ = db.AddError(fmt.Errorf("%w: %v", ErrCrossTenantWrite, current))
+		}
+		return
+	}
+
+	if err := field.Set(db.Statement.Context, value, tenantID); err != nil {
+		_ = db.AddError(fmt.Errorf("set tenant column error: %w", err))
+	}
+}
+
+func (t *Tenancy) scopeUpdate(db *gorm.DB) {
+	tenantID, scoped := t.tenant(db)
+	if !scoped {
+		return
+	}
+
+	t.scope(db, tenantID)
+	if t.schemaPerTenant {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(t.column)
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]any:
+		for _, key := range []string{field.DBName, field.Name} {
+			if value, exist := dest[key]; exist && !sameTenant(value, tenantID) {
+				_ = db.AddError(fmt.Errorf("%w: %v", ErrCrossTenantWrite, value))
+			}
+		}
+	default:
+		if value := reflect.Indirect(reflect.ValueOf(dest)); value.Kind() == reflect.Struct && value.Type() == db.Statement.Schema.ModelType {
+			if current, isZero := field.ValueOf(db.Statement.Context, value); !isZero && !sameTenant(current, tenantID) {
+				_ = db.AddError(fmt.Errorf("%w: %v", ErrCrossTenantWrite, current))
+			}
+		}
+	}
+}
+
+func sameTenant(value, tenantID any) bool {
+	return fmt.Sprint(reflect.Indirect(reflect.ValueOf(value))) == fmt.Sprint(tenantID)
+}
@@ -0,0 +1,82 @@
+package tenancy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alioth-center/infrastructure/database/sqlite"
+	"github.com/alioth-center/infrastructure/logger"
+	"github.com/alioth-center/infrastructure/trace"
+)
+
+type project struct {
+	ID       int    `gorm:"primaryKey;column:id;autoIncrement"`
+	TenantID string `gorm:"column:tenant_id"`
+	Name     string `gorm:"column:name"`
+}
+
+type country struct {
+	Code string `gorm:"primaryKey;column:code"`
+}
+
+func TestTenancy(t *testing.T) {
+	db, err := sqlite.NewWithLogger(sqlite.Config{Database: "file:tenancy_test?mode=memory&cache=shared"}, logger.Mute(), &project{}, &country{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Register(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Register(db, WithSchemaPerTenantOpts(nil)); !errors.Is(err, ErrSchemaPerTenantUnsupported) {
+		t.Fatalf("expected schema per tenant to be refused on sqlite, got %v", err)
+	}
+
+	tenantA, tenantB := WithTenant(trace.NewContext(), "a"), WithTenant(trace.NewContext(), "b")
+	created := &project{Name: "alpha"}
+	if _, err = db.CreateSingleDataIfNotExist(tenantA, created); err != nil || created.TenantID != "a" {
+		t.Fatalf("expected tenant to be filled, got %+v, error %v", created, err)
+	}
+	if _, err = db.CreateSingleDataIfNotExist(tenantB, &project{Name: "beta"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.CreateSingleDataIfNotExist(tenantA, &project{Name: "gamma", TenantID: "b"}); !errors.Is(err, ErrCrossTenantWrite) {
+		t.Fatalf("expected cross tenant create to be refused, got %v", err)
+	}
+
+	var projects []project
+	if err = db.ListDataWithPage(tenantA, &projects, map[string]any{}, "id", false, 0, 10); err != nil || len(projects) != 1 || projects[0].Name != "alpha" {
+		t.Fatalf("expected only the projects of tenant a, got %+v, error %v", projects, err)
+	}
+
+	if err = db.GetGormCore(tenantB).Model(&project{}).Where("id = ?", created.ID).Updates(map[string]any{"name": "hijacked"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = db.UpdateDataBySingleCondition(tenantA, &project{TenantID: "b"}, "id", created.ID); !errors.Is(err, ErrCrossTenantWrite) {
+		t.Fatalf("expected moving data to another tenant to be refused, got %v", err)
+	}
+
+	var stored project
+	if err = db.GetDataBySingleCondition(WithoutTenant(trace.NewContext()), &stored, "id", created.ID); err != nil || stored.Name != "alpha" || stored.TenantID != "a" {
+		t.Fatalf("expected project of tenant a to be untouched, got %+v, error %v", stored, err)
+	}
+
+	if err = db.GetDataBySingleCondition(trace.NewContext(), &stored, "id", created.ID); !errors.Is(err, ErrMissingTenant) {
+		t.Fatalf("expected missing tenant error, got %v", err)
+	}
+	if _, err = db.CreateSingleDataIfNotExist(trace.NewContext(), &country{Code: "cn"}); err != nil {
+		t.Fatalf("expected tables without tenant column to be unaffected, got %v", err)
+	}
+
+	if err = db.SoftDeleteData(tenantB, &project{}, map[string]any{"id": created.ID}); err == nil {
+		t.Fatal("expected soft delete to be refused for models without deleted_at")
+	}
+	if err = db.GetGormCore(tenantB).Where("id = ?", created.ID).Delete(&project{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.GetGormCore(WithoutTenant(trace.NewContext())).Model(&project{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected delete of another tenant to affect nothing, got %d rows", count)
+	}
+}
@@ -0,0 +1,301 @@
+// Package fixtures loads the test data from yaml or json files into the tables of a database.
+//
+// A fixture file maps the table names to the rows, a row can be labeled by the _label key, and the
+// other rows can reference its columns by the string $ref:table.label.column, the column defaults
+// to id. The referenced columns should be given in the fixtures, generated values are not resolved.
+//
+// example:
+//
+//	users:
+//	  - _label: alice
+//	    id: 1
+//	    name: alice
+//	orders:
+//	  - id: 1
+//	    user_id: $ref:users.alice
+//	    title: the first order
+package fixtures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alioth-center/infrastructure/config"
+	"github.com/alioth-center/infrastructure/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// LabelKey is the key of the row label, it is not inserted into the table.
+	LabelKey = "_label"
+
+	// ReferencePrefix is the prefix of the values referencing the column of another row.
+	ReferencePrefix = "$ref:"
+
+	defaultReferenceColumn = "id"
+)
+
+var (
+	ErrInvalidReference    = errors.New("invalid fixture reference")
+	ErrUnresolvedReference = errors.New("unresolved fixture reference")
+	ErrDuplicateLabel      = errors.New("duplicate fixture label")
+	ErrCircularReference   = errors.New("circular fixture reference")
+)
+
+type reference struct {
+	table  string
+	label  string
+	column string
+}
+
+func parseReference(value any) (ref reference, ok bool, err error) {
+	text, isString := value.(string)
+	if !isString || !strings.HasPrefix(text, ReferencePrefix) {
+		return ref, false, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(text, ReferencePrefix), ".")
+	switch {
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return reference{table: parts[0], label: parts[1], column: defaultReferenceColumn}, true, nil
+	case len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "":
+		return reference{table: parts[0], label: parts[1], column: parts[2]}, true, nil
+	default:
+		return ref, false, fmt.Errorf("%w: %s", ErrInvalidReference, text)
+	}
+}
+
+// Fixtures is the parsed fixture files, the tables are ordered so that the referenced tables come first.
+type Fixtures struct {
+	tables []string
+	rows   map[string][]map[string]any
+	labels map[string]map[string]map[string]any
+}
+
+// New reads the fixture files, the rows of the same table in different files are merged in order.
+//
+// Parameters:
+//
+//	paths (...string): The paths of the fixture files, the format is detected by the extension.
+//
+// Returns:
+//
+//	fixtures (*Fixtures): The parsed fixtures.
+//	err (error): An error if the files cannot be read, or the references are invalid or circular, otherwise nil.
+func New(paths ...string) (fixtures *Fixtures, err error) {
+	fixtures = &Fixtures{rows: map[string][]map[string]any{}}
+	for _, path := range paths {
+		content := map[string][]map[string]any{}
+		if loadErr := config.LoadConfig(&content, path); loadErr != nil {
+			return nil, fmt.Errorf("load fixture file %s error: %w", path, loadErr)
+		}
+
+		for table, rows := range content {
+			fixtures.rows[table] = append(fixtures.rows[table], rows...)
+		}
+	}
+
+	if sortErr := fixtures.sortTables(); sortErr != nil {
+		return nil, sortErr
+	}
+
+	return fixtures, nil
+}
+
+// sortTables orders the tables topologically by the references, the independent tables are ordered by name.
+func (f *Fixtures) sortTables() error {
+	dependencies := make(map[string]map[string]bool, len(f.rows))
+	for table, rows := range f.rows {
+		dependencies[table] = map[string]bool{}
+		for _, row := range rows {
+			for _, value := range row {
+				ref, isRef, err := parseReference(value)
+				if err != nil {
+					return err
+				}
+				if !isRef || ref.table == table {
+					continue
+				}
+				if _, exist := f.rows[ref.table]; !exist {
+					return fmt.Errorf("%w: table %s is not in the fixtures", ErrUnresolvedReference, ref.table)
+				}
+
+				dependencies[table][ref.table] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(f.rows))
+	for table := range f.rows {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[string]int, len(names))
+	f.tables = make([]string, 0, len(names))
+
+	var visit func(table string) error
+	visit = func(table string) error {
+		switch states[table] {
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrCircularReference, table)
+		case visited:
+			return nil
+		}
+
+		states[table] = visiting
+		dependsOn := make([]string, 0, len(dependencies[table]))
+		for dependency := range dependencies[table] {
+			dependsOn = append(dependsOn, dependency)
+		}
+		sort.Strings(dependsOn)
+		for _, dependency := range dependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		states[table] = visited
+		f.tables = append(f.tables, table)
+		return nil
+	}
+
+	for _, table := range names {
+		if err := visit(table); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Tables returns the tables of the fixtures in the insertion order.
+func (f *Fixtures) Tables() []string {
+	return append([]string(nil), f.tables...)
+}
+
+// Row returns the resolved row of the label after the fixtures are inserted, nil if the label is not found.
+func (f *Fixtures) Row(table, label string) map[string]any {
+	return f.labels[table][label]
+}
+
+// resolve builds the row to insert, the label is removed and the references are replaced by the values.
+func (f *Fixtures) resolve(table string, row map[string]any) (resolved map[string]any, label string, err error) {
+	resolved = make(map[string]any, len(row))
+	for column, value := range row {
+		if column == LabelKey {
+			label = fmt.Sprint(value)
+			continue
+		}
+
+		ref, isRef, parseErr := parseReference(value)
+		if parseErr != nil {
+			return nil, "", parseErr
+		}
+		if !isRef {
+			resolved[column] = value
+			continue
+		}
+
+		referenced, exist := f.labels[ref.table][ref.label]
+		if !exist {
+			return nil, "", fmt.Errorf("%w: label %s of table %s is not inserted before %s", ErrUnresolvedReference, ref.label, ref.table, table)
+		}
+		referencedValue, exist := referenced[ref.column]
+		if !exist {
+			return nil, "", fmt.Errorf("%w: column %s of %s.%s is not given", ErrUnresolvedReference, ref.column, ref.table, ref.label)
+		}
+
+		resolved[column] = referencedValue
+	}
+
+	return resolved, label, nil
+}
+
+// Insert inserts the fixtures into the database in one transaction.
+func (f *Fixtures) Insert(ctx context.Context, db database.DatabaseV2) error {
+	f.labels = make(map[string]map[string]map[string]any, len(f.tables))
+	return db.GetGormCore(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range f.tables {
+			f.labels[table] = map[string]map[string]any{}
+			for _, row := range f.rows[table] {
+				resolved, label, err := f.resolve(table, row)
+				if err != nil {
+					return err
+				}
+
+				if label != "" {
+					if _, duplicated := f.labels[table][label]; duplicated {
+						return fmt.Errorf("%w: %s of table %s", ErrDuplicateLabel, label, table)
+					}
+					f.labels[table][label] = resolved
+				}
+
+				if createErr := tx.Table(table).Create(copyRow(resolved)).Error; createErr != nil {
+					return fmt.Errorf("insert fixture into %s error: %w", table, createErr)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Clean deletes all the rows of the fixture tables in the reverse insertion order.
+func (f *Fixtures) Clean(ctx context.Context, db database.DatabaseV2) error {
+	return db.GetGormCore(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := len(f.tables) - 1; i >= 0; i-- {
+			if err := tx.Exec("DELETE FROM ?", clause.Table{Name: f.tables[i]}).Error; err != nil {
+				return fmt.Errorf("clean fixture table %s error: %w", f.tables[i], err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Reload cleans the fixture tables and inserts the fixtures again, it is usually called before each test.
+func (f *Fixtures) Reload(ctx context.Context, db database.DatabaseV2) error {
+	if err := f.Clean(ctx, db); err != nil {
+		return err
+	}
+
+	return f.Insert(ctx, db)
+}
+
+// Load reads the fixture files and inserts them into the database.
+//
+// example:
+//
+//	fixtures, err := fixtures.Load(ctx, db, "testdata/users.yaml", "testdata/orders.yaml")
+func Load(ctx context.Context, db database.DatabaseV2, paths ...string) (fixtures *Fixtures, err error) {
+	fixtures, err = New(paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	if insertErr := fixtures.Insert(ctx, db); insertErr != nil {
+		return nil, insertErr
+	}
+
+	return fixtures, nil
+}
+
+// copyRow copies the row because gorm may write the generated values into the map.
+func copyRow(row map[string]any) map[string]any {
+	copied := make(map[string]any, len(row))
+	for key, value := range row {
+		copied[key] = value
+	}
+
+	return copied
+}
@@ -0,0 +1,55 @@
+package fixtures
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alioth-center/infrastructure/database"
+	"github.com/alioth-center/infrastructure/database/sqlite"
+	"github.com/alioth-center/infrastructure/logger"
+)
+
+var memoryDatabaseSequence atomic.Int64
+
+// NewMemoryDatabase opens an in-memory sqlite database migrated with the models, each call gets a new
+// database which is closed when the test finishes, the sql logs are muted.
+//
+// example:
+//
+//	func TestUser(t *testing.T) {
+//		db := fixtures.NewMemoryDatabase(t, &User{}, &Order{})
+//		fixtures.MustLoad(t, db, "testdata/users.yaml")
+//	}
+func NewMemoryDatabase(t testing.TB, models ...any) database.DatabaseV2 {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	dataSource := fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", name, memoryDatabaseSequence.Add(1))
+	db, err := sqlite.NewWithLogger(sqlite.Config{Database: dataSource}, logger.Mute(), models...)
+	if err != nil {
+		t.Fatalf("open memory database error: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDb, dbErr := db.GetGormCore(context.Background()).DB(); dbErr == nil {
+			_ = sqlDb.Close()
+		}
+	})
+
+	return db
+}
+
+// MustLoad loads the fixture files into the database and fails the test on error.
+func MustLoad(t testing.TB, db database.DatabaseV2, paths ...string) *Fixtures {
+	t.Helper()
+
+	fixtures, err := Load(context.Background(), db, paths...)
+	if err != nil {
+		t.Fatalf("load fixtures error: %v", err)
+	}
+
+	return fixtures
+}
@@ -0,0 +1,54 @@
+package fixtures
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type user struct {
+	ID   int    `gorm:"primaryKey;column:id"`
+	Name string `gorm:"column:name"`
+}
+
+type order struct {
+	ID     int    `gorm:"primaryKey;column:id"`
+	UserID int    `gorm:"column:user_id"`
+	Title  string `gorm:"column:title"`
+}
+
+func TestFixtures(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDatabase(t, &user{}, &order{})
+	fixtures := MustLoad(t, db, "testdata/orders.json", "testdata/users.yaml")
+
+	if tables := fixtures.Tables(); len(tables) != 2 || tables[0] != "users" || tables[1] != "orders" {
+		t.Fatalf("unexpected table order: %v", tables)
+	}
+
+	var orders []order
+	if err := db.GetGormCore(ctx).Order("id").Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 || orders[0].UserID != 1 || orders[1].UserID != 2 {
+		t.Fatalf("unexpected orders: %+v", orders)
+	}
+	if row := fixtures.Row("users", "bob"); row == nil || row["name"] != "bob" {
+		t.Fatalf("unexpected labeled row: %v", row)
+	}
+
+	db.GetGormCore(ctx).Create(&user{ID: 3, Name: "carol"})
+	if err := fixtures.Reload(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	db.GetGormCore(ctx).Model(&user{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected reload to reset users, got %d", count)
+	}
+
+	if _, err := New("testdata/orders.json"); !errors.Is(err, ErrUnresolvedReference) {
+		t.Fatalf("expected unresolved reference error, got %v", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"reflect"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 
 	"github.com/alioth-center/infrastructure/utils/values"
 )
@@ -50,3 +52,71 @@ func ColumnAlias(tableName, columnName, alias string) string {
 func JoinSubQueryAlias(query *gorm.DB, alias string) string {
 	return values.BuildStrings("(", query.Statement.SQL.String(), ") as ", alias)
 }
+
+// LoadAffectedRows loads the rows which the statement of db is going to update or delete into receiver,
+// it is designed to be called in gorm callbacks registered before "gorm:update" or "gorm:delete".
+// The receiver can be a pointer to a slice of the model or a pointer to []map[string]any.
+func LoadAffectedRows(db *gorm.DB, receiver any) error {
+	stmt := db.Statement
+	if stmt.Schema == nil {
+		return ErrInvalidCondition
+	}
+
+	query := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Model(reflect.New(stmt.Schema.ModelType).Interface())
+	if stmt.Table != "" {
+		query = query.Table(stmt.Table)
+	}
+	if stmt.Unscoped {
+		query = query.Unscoped()
+	}
+
+	conditions := 0
+	if where, exist := stmt.Clauses["WHERE"]; exist {
+		if expression, ok := where.Expression.(clause.Where); ok && len(expression.Exprs) > 0 {
+			query = query.Clauses(clause.Where{Exprs: expression.Exprs})
+			conditions++
+		}
+	}
+
+	if modelValue := stmt.ReflectValue; modelValue.IsValid() && len(stmt.Schema.PrimaryFields) > 0 {
+		valueType := modelValue.Type()
+		if modelValue.Kind() == reflect.Slice || modelValue.Kind() == reflect.Array {
+			valueType = valueType.Elem()
+		}
+		for valueType.Kind() == reflect.Ptr {
+			valueType = valueType.Elem()
+		}
+
+		if valueType == stmt.Schema.ModelType {
+			_, primaryValues := schema.GetIdentityFieldValuesMap(stmt.Context, modelValue, stmt.Schema.PrimaryFields)
+			column, queryValues := schema.ToQueryValues(clause.CurrentTable, stmt.Schema.PrimaryFieldDBNames, primaryValues)
+			if len(queryValues) > 0 {
+				query = query.Clauses(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: queryValues}}})
+				conditions++
+			}
+		}
+	}
+
+	// gorm refuses global updates and deletes, so there is nothing to load
+	if conditions == 0 && !stmt.AllowGlobalUpdate {
+		return nil
+	}
+
+	return query.Find(receiver).Error
+}
+
+// SoftDeleteField returns the soft delete field of the model, returns nil if the model does not support soft delete.
+func SoftDeleteField(db *gorm.DB, model any) (field *schema.Field, err error) {
+	stmt := &gorm.Statement{DB: db}
+	if parseErr := stmt.Parse(model); parseErr != nil {
+		return nil, parseErr
+	}
+
+	for _, deleteClause := range stmt.Schema.DeleteClauses {
+		if softDelete, ok := deleteClause.(gorm.SoftDeleteDeleteClause); ok {
+			return softDelete.Field, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"reflect"
 	"time"
 
 	"gorm.io/gorm/clause"
@@ -85,6 +86,7 @@ func (s *BaseDatabaseImplement) Migrate(models ...any) error {
 	if migrateErr != nil {
 		s.Logger.Error(logger.NewFields().WithMessage(migrateErr.Error()).WithData(models))
 	}
+	RegisterModels(models...)
 	return migrateErr
 }
 
@@ -335,12 +337,22 @@ func (s *BaseDatabaseImplement) SetLogger(logger logger.Logger) {
 
 type BaseDatabaseImplementV2 struct {
 	Db *gorm.DB
+
+	// Timeout bounds every operation except GetGormCore and Transaction, it can be overridden by WithTimeout.
+	Timeout time.Duration
+
+	// MaxIdle is the max idle connections set by Options.MaxIdle, it is reported by PoolStats.
+	MaxIdle int
 }
 
 func (v2 *BaseDatabaseImplementV2) GetGormCore(ctx context.Context) *gorm.DB {
 	return v2.Db.WithContext(ctx)
 }
 
+func (v2 *BaseDatabaseImplementV2) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return runTransaction(v2.Db.WithContext(ctx), fn)
+}
+
 func (v2 *BaseDatabaseImplementV2) GetDataBySingleCondition(ctx context.Context, receiver any, column string, condition any, needFields ...string) error {
 	if column == "" || condition == nil || EmptySlice(condition) {
 		return ErrInvalidCondition
@@ -350,11 +362,14 @@ func (v2 *BaseDatabaseImplementV2) GetDataBySingleCondition(ctx context.Context,
 		needFields = append(needFields, "*")
 	}
 
-	return v2.Db.WithContext(ctx).Model(receiver).Where(column, condition).Select(needFields).Scan(receiver).Error
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Model(receiver).Where(column, condition).Select(needFields).Scan(receiver).Error)
 }
 
 func (v2 *BaseDatabaseImplementV2) GetDataByCustomCondition(ctx context.Context, receiver, condition any, needFields ...string) error {
-	if condition == nil || EmptySlice(condition) {
+	if EmptyCondition(condition) {
 		return ErrInvalidCondition
 	}
 
@@ -362,11 +377,14 @@ func (v2 *BaseDatabaseImplementV2) GetDataByCustomCondition(ctx context.Context,
 		needFields = append(needFields, "*")
 	}
 
-	return v2.Db.WithContext(ctx).Model(receiver).Where(condition).Select(needFields).Scan(receiver).Error
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Model(receiver).Where(condition).Select(needFields).Scan(receiver).Error)
 }
 
 func (v2 *BaseDatabaseImplementV2) ListDataWithPage(ctx context.Context, receiver any, filter any, order string, desc bool, offset, limit int, needFields ...string) error {
-	if filter == nil || EmptySlice(filter) {
+	if EmptyCondition(filter) {
 		return ErrInvalidCondition
 	}
 
@@ -374,9 +392,12 @@ func (v2 *BaseDatabaseImplementV2) ListDataWithPage(ctx context.Context, receive
 		needFields = append(needFields, "*")
 	}
 
-	return v2.Db.WithContext(ctx).Model(receiver).Where(filter).Order(clause.OrderByColumn{
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Model(receiver).Where(filter).Order(clause.OrderByColumn{
 		Column: clause.Column{Name: order}, Desc: desc,
-	}).Limit(limit).Offset(offset * limit).Select(needFields).Scan(receiver).Error
+	}).Limit(limit).Offset(offset*limit).Select(needFields).Scan(receiver).Error)
 }
 
 func (v2 *BaseDatabaseImplementV2) CreateSingleDataIfNotExist(ctx context.Context, data any) (created bool, err error) {
@@ -384,9 +405,12 @@ func (v2 *BaseDatabaseImplementV2) CreateSingleDataIfNotExist(ctx context.Contex
 		return false, ErrInvalidSingleData
 	}
 
-	session := v2.Db.WithContext(ctx).Model(data).Clauses(clause.OnConflict{DoNothing: true}).Create(data)
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	session := db.Model(data).Clauses(clause.OnConflict{DoNothing: true}).Create(data)
 	if session.Error != nil {
-		return false, session.Error
+		return false, classifyOperationError(operation, session.Error)
 	}
 
 	return session.RowsAffected > 0, nil
@@ -402,10 +426,63 @@ func (v2 *BaseDatabaseImplementV2) CreateDataOnDuplicateKeyUpdate(ctx context.Co
 		duplicatedColumns[i] = clause.Column{Name: key}
 	}
 
-	return v2.Db.WithContext(ctx).Model(data).Clauses(clause.OnConflict{
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Model(data).Clauses(clause.OnConflict{
 		Columns:   duplicatedColumns,
 		DoUpdates: clause.AssignmentColumns(updateFields),
-	}).Create(data).Error
+	}).Create(data).Error)
+}
+
+func (v2 *BaseDatabaseImplementV2) BatchUpsert(ctx context.Context, rows any, batchSize int, indexKeys, updateFields []string, inTransaction bool) (result UpsertResult, err error) {
+	if len(indexKeys) == 0 || len(updateFields) == 0 {
+		return result, ErrInvalidCondition
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(rows))
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return result, ErrInvalidBatchData
+	}
+	if value.Len() == 0 {
+		return result, nil
+	}
+	if !value.CanAddr() {
+		// the arrays passed by value cannot be sliced into the chunks
+		addressable := reflect.New(value.Type()).Elem()
+		addressable.Set(value)
+		value = addressable
+	}
+
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	size, parseErr := upsertBatchSize(db, rows, batchSize)
+	if parseErr != nil {
+		return result, parseErr
+	}
+
+	duplicatedColumns := make([]clause.Column, len(indexKeys))
+	for i, key := range indexKeys {
+		duplicatedColumns[i] = clause.Column{Name: key}
+	}
+	onConflict := clause.OnConflict{Columns: duplicatedColumns, DoUpdates: clause.AssignmentColumns(updateFields)}
+
+	if !inTransaction {
+		result, err = upsertChunks(db, value, size, onConflict)
+		return result, classifyOperationError(operation, err)
+	}
+
+	err = runTransaction(db, func(tx *gorm.DB) error {
+		var upsertErr error
+		result, upsertErr = upsertChunks(tx, value, size, onConflict)
+		return upsertErr
+	})
+	if err != nil {
+		return UpsertResult{}, classifyOperationError(operation, err)
+	}
+
+	return result, nil
 }
 
 func (v2 *BaseDatabaseImplementV2) UpdateDataBySingleCondition(ctx context.Context, updates any, column string, condition any) error {
@@ -413,34 +490,145 @@ func (v2 *BaseDatabaseImplementV2) UpdateDataBySingleCondition(ctx context.Conte
 		return ErrInvalidCondition
 	}
 
-	return v2.Db.WithContext(ctx).Model(updates).Where(column, condition).Updates(updates).Error
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	model, values := updatesOf(updates)
+	return classifyOperationError(operation, updateWithVersion(operation, db.Model(model).Where(column, condition), values))
 }
 
 func (v2 *BaseDatabaseImplementV2) UpdateDataByCustomCondition(ctx context.Context, updates, condition any) error {
-	if condition == nil || EmptySlice(condition) {
+	if EmptyCondition(condition) {
 		return ErrInvalidCondition
 	}
 
-	return v2.Db.WithContext(ctx).Model(updates).Where(condition).Updates(updates).Error
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	model, values := updatesOf(updates)
+	return classifyOperationError(operation, updateWithVersion(operation, db.Model(model).Where(condition), values))
+}
+
+func (v2 *BaseDatabaseImplementV2) SoftDeleteData(ctx context.Context, model, condition any) error {
+	if EmptyCondition(condition) {
+		return ErrInvalidCondition
+	}
+
+	field, err := SoftDeleteField(v2.Db, model)
+	if err != nil {
+		return err
+	} else if field == nil {
+		return ErrSoftDeleteUnsupported
+	}
+
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Model(model).Where(condition).Delete(model).Error)
+}
+
+func (v2 *BaseDatabaseImplementV2) RestoreData(ctx context.Context, model, condition any) error {
+	if EmptyCondition(condition) {
+		return ErrInvalidCondition
+	}
+
+	field, err := SoftDeleteField(v2.Db, model)
+	if err != nil {
+		return err
+	} else if field == nil {
+		return ErrSoftDeleteUnsupported
+	}
+
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Unscoped().Model(model).Where(condition).Where(clause.Neq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil,
+	}).Update(field.DBName, nil).Error)
+}
+
+func (v2 *BaseDatabaseImplementV2) ListDataWithDeleted(ctx context.Context, receiver any, filter any, order string, desc bool, offset, limit int, needFields ...string) error {
+	if EmptyCondition(filter) {
+		return ErrInvalidCondition
+	}
+
+	if len(needFields) == 0 {
+		needFields = append(needFields, "*")
+	}
+
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Unscoped().Model(receiver).Where(filter).Order(clause.OrderByColumn{
+		Column: clause.Column{Name: order}, Desc: desc,
+	}).Limit(limit).Offset(offset*limit).Select(needFields).Scan(receiver).Error)
 }
 
 func (v2 *BaseDatabaseImplementV2) ExecuteRawSqlTemplateQuery(ctx context.Context, receiver any, sql string, template RawSqlTemplate) error {
-	return v2.Db.WithContext(ctx).Raw(template.ParseTemplate(sql)).Scan(receiver).Error
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Raw(template.ParseTemplate(sql)).Scan(receiver).Error)
 }
 
 func (v2 *BaseDatabaseImplementV2) ExecuteRawSqlTemplate(ctx context.Context, sql string, template RawSqlTemplate) error {
-	return v2.Db.WithContext(ctx).Exec(template.ParseTemplate(sql)).Error
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Exec(template.ParseTemplate(sql)).Error)
+}
+
+func (v2 *BaseDatabaseImplementV2) ExecuteNamedSqlQuery(ctx context.Context, receiver any, sql string, params map[string]any) error {
+	expression, err := namedSqlExpression(sql, params)
+	if err != nil {
+		return err
+	}
+
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Raw("?", expression).Scan(receiver).Error)
+}
+
+func (v2 *BaseDatabaseImplementV2) ExecuteNamedSql(ctx context.Context, sql string, params map[string]any) error {
+	expression, err := namedSqlExpression(sql, params)
+	if err != nil {
+		return err
+	}
+
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Exec("?", expression).Error)
+}
+
+func (v2 *BaseDatabaseImplementV2) HealthCheck(ctx context.Context) error {
+	return HealthCheck(ctx, v2.Db.WithContext(ctx))
+}
+
+func (v2 *BaseDatabaseImplementV2) PoolStats() PoolStats {
+	stats := GetPoolStats(v2.Db)
+	stats.MaxIdle = v2.MaxIdle
+	return stats
 }
 
 func (v2 *BaseDatabaseImplementV2) ExecuteRawSqlQuery(ctx context.Context, receiver any, sql string) error {
-	return v2.Db.WithContext(ctx).Raw(sql).Scan(receiver).Error
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Raw(sql).Scan(receiver).Error)
 }
 
 func (v2 *BaseDatabaseImplementV2) ExecuteRawSql(ctx context.Context, sql string) error {
-	return v2.Db.WithContext(ctx).Exec(sql).Error
+	db, operation, cancel := v2.session(ctx)
+	defer cancel()
+
+	return classifyOperationError(operation, db.Exec(sql).Error)
 }
 
 var (
-	ErrInvalidCondition  = errors.New("invalid condition")
-	ErrInvalidSingleData = errors.New("invalid single data")
+	ErrInvalidCondition      = errors.New("invalid condition")
+	ErrInvalidSingleData     = errors.New("invalid single data")
+	ErrSoftDeleteUnsupported = errors.New("model does not support soft delete")
+	ErrInvalidBatchData      = errors.New("invalid batch data, must be a slice or an array")
 )
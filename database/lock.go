@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// VersionTagKey is the struct tag key marking the version column used by optimistic locking.
+	VersionTagKey = "lock"
+
+	// VersionTagValue is the struct tag value marking the version column used by optimistic locking, e.g.
+	//
+	//	type User struct {
+	//		ID      int   `gorm:"column:id;primaryKey"`
+	//		Version int64 `gorm:"column:version" lock:"version"`
+	//	}
+	VersionTagValue = "version"
+)
+
+// ErrStaleData is returned by the UpdateData* methods when the updates carry a version column
+// and no row with the same version is found, which means the data has been changed by others.
+var ErrStaleData = errors.New("stale data, the row has been modified")
+
+type versionField struct {
+	field   *schema.Field
+	value   reflect.Value
+	current int64
+}
+
+func (v versionField) set(ctx context.Context, version int64) {
+	_ = v.field.Set(ctx, v.value, version)
+}
+
+// lookupVersionField finds the version field of the updates, ok is false if the updates
+// is not a struct or the struct has no field tagged with lock:"version".
+func lookupVersionField(ctx context.Context, db *gorm.DB, updates any) (version versionField, ok bool) {
+	value := reflect.ValueOf(updates)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return version, false
+	}
+
+	value = reflect.Indirect(value)
+	if value.Kind() != reflect.Struct {
+		return version, false
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(updates); err != nil {
+		return version, false
+	}
+
+	for _, field := range stmt.Schema.Fields {
+		if field.Tag.Get(VersionTagKey) != VersionTagValue || field.DBName == "" {
+			continue
+		}
+
+		current := field.ReflectValueOf(ctx, value)
+		switch current.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return versionField{field: field, value: value, current: current.Int()}, true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return versionField{field: field, value: value, current: int64(current.Uint())}, true
+		default:
+			return version, false
+		}
+	}
+
+	return version, false
+}
+
+// updateWithVersion executes the updates, if the updates carry a version column, the update only matches
+// the rows with the same version and increases it, returns ErrStaleData when nothing is updated.
+func updateWithVersion(ctx context.Context, tx *gorm.DB, updates any) error {
+	version, locked := lookupVersionField(ctx, tx, updates)
+	if !locked {
+		return tx.Updates(updates).Error
+	}
+
+	version.set(ctx, version.current+1)
+	result := tx.Where(clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: version.field.DBName}, Value: version.current,
+	}).Updates(updates)
+	if result.Error != nil {
+		version.set(ctx, version.current)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		version.set(ctx, version.current)
+		return ErrStaleData
+	}
+
+	return nil
+}
+
+// UpdateWithOptimisticLock loads the row matching the condition, applies the mutation and updates it with
+// the version check. When the update meets ErrStaleData, the row is reloaded and the mutation is reapplied,
+// at most maxRetries times. The model T must have a version field tagged with lock:"version", and the
+// mutation should be idempotent on the loaded row, zero values set by the mutation are not updated.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for the database operation.
+//	db (DatabaseV2): The database to operate.
+//	column (string): The column name to apply the condition.
+//	condition (any): The condition value for the specified column.
+//	maxRetries (int): The max times to retry after a stale update.
+//	mutate (func(data *T) error): The mutation applied to the loaded row, returning an error aborts the update.
+//
+// Returns:
+//
+//	data (*T): The updated row.
+//	err (error): An error if the operation fails, ErrStaleData if the retries are exhausted, otherwise nil.
+//
+// Example:
+//
+//	user, err := database.UpdateWithOptimisticLock(ctx, db, "id", 1, 3, func(user *User) error {
+//		user.Balance += 100
+//		return nil
+//	})
+func UpdateWithOptimisticLock[T any](ctx context.Context, db DatabaseV2, column string, condition any, maxRetries int, mutate func(data *T) error) (data *T, err error) {
+	if column == "" || condition == nil || EmptySlice(condition) {
+		return nil, ErrInvalidCondition
+	}
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		data = new(T)
+		if loadErr := db.GetGormCore(ctx).Where(column, condition).Take(data).Error; loadErr != nil {
+			return nil, loadErr
+		}
+
+		if mutateErr := mutate(data); mutateErr != nil {
+			return nil, mutateErr
+		}
+
+		err = db.UpdateDataBySingleCondition(ctx, data, column, condition)
+		if !errors.Is(err, ErrStaleData) {
+			return data, err
+		}
+	}
+
+	return nil, err
+}
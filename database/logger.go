@@ -2,18 +2,206 @@ package database
 
 import (
 	"context"
+	"math"
+	"math/rand"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/alioth-center/infrastructure/logger"
+	"gorm.io/gorm"
 	glog "gorm.io/gorm/logger"
 )
 
+// StatementKind is the kind of sql statement, detected by the leading keyword of the sql.
+type StatementKind string
+
+const (
+	StatementKindSelect StatementKind = "select"
+	StatementKindInsert StatementKind = "insert"
+	StatementKindUpdate StatementKind = "update"
+	StatementKindDelete StatementKind = "delete"
+	StatementKindOther  StatementKind = "other"
+)
+
+var (
+	statementKinds = []StatementKind{StatementKindSelect, StatementKindInsert, StatementKindUpdate, StatementKindDelete, StatementKindOther}
+
+	// latencyBuckets are the upper bounds of the latency histogram, the last bucket collects everything above.
+	latencyBuckets = []time.Duration{
+		time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+		100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second, time.Duration(math.MaxInt64),
+	}
+)
+
+// LatencyBucket is a single bucket of the latency histogram, Count is the number of statements whose
+// duration is less than or equal to UpperBound and greater than the upper bound of the previous bucket.
+type LatencyBucket struct {
+	UpperBound time.Duration `json:"upper_bound"`
+	Count      int64         `json:"count"`
+}
+
+// StatementMetrics is the snapshot of the metrics of a statement kind.
+type StatementMetrics struct {
+	Kind          StatementKind   `json:"kind"`
+	Count         int64           `json:"count"`
+	Errors        int64           `json:"errors"`
+	Slow          int64           `json:"slow"`
+	TotalDuration time.Duration   `json:"total_duration"`
+	MaxDuration   time.Duration   `json:"max_duration"`
+	Buckets       []LatencyBucket `json:"buckets"`
+}
+
+type statementCounter struct {
+	count   atomic.Int64
+	errors  atomic.Int64
+	slow    atomic.Int64
+	total   atomic.Int64
+	max     atomic.Int64
+	buckets []atomic.Int64
+}
+
+func (c *statementCounter) observe(elapsed time.Duration, failed, slow bool) {
+	c.count.Add(1)
+	c.total.Add(int64(elapsed))
+	if failed {
+		c.errors.Add(1)
+	}
+	if slow {
+		c.slow.Add(1)
+	}
+
+	for current := c.max.Load(); int64(elapsed) > current; current = c.max.Load() {
+		if c.max.CompareAndSwap(current, int64(elapsed)) {
+			break
+		}
+	}
+
+	for i, bound := range latencyBuckets {
+		if elapsed <= bound {
+			c.buckets[i].Add(1)
+			break
+		}
+	}
+}
+
+func (c *statementCounter) export(kind StatementKind) StatementMetrics {
+	buckets := make([]LatencyBucket, len(latencyBuckets))
+	for i, bound := range latencyBuckets {
+		buckets[i] = LatencyBucket{UpperBound: bound, Count: c.buckets[i].Load()}
+	}
+
+	return StatementMetrics{
+		Kind:          kind,
+		Count:         c.count.Load(),
+		Errors:        c.errors.Load(),
+		Slow:          c.slow.Load(),
+		TotalDuration: time.Duration(c.total.Load()),
+		MaxDuration:   time.Duration(c.max.Load()),
+		Buckets:       buckets,
+	}
+}
+
+type statementCounters map[StatementKind]*statementCounter
+
+func newStatementCounters() *statementCounters {
+	counters := make(statementCounters, len(statementKinds))
+	for _, kind := range statementKinds {
+		counters[kind] = &statementCounter{buckets: make([]atomic.Int64, len(latencyBuckets))}
+	}
+
+	return &counters
+}
+
+// DetectStatementKind detects the kind of the sql statement by its leading keyword.
+func DetectStatementKind(sql string) StatementKind {
+	trimmed := strings.TrimLeft(sql, " \t\r\n(")
+	if end := strings.IndexAny(trimmed, " \t\r\n("); end > 0 {
+		trimmed = trimmed[:end]
+	}
+
+	switch strings.ToLower(trimmed) {
+	case "select", "with", "show", "explain":
+		return StatementKindSelect
+	case "insert", "replace":
+		return StatementKindInsert
+	case "update":
+		return StatementKindUpdate
+	case "delete":
+		return StatementKindDelete
+	default:
+		return StatementKindOther
+	}
+}
+
+// DBLoggerOption is the option of DBLogger.
+type DBLoggerOption func(*DBLogger)
+
+// WithSlowThresholdOpts sets the threshold of slow sql, statements cost longer than the threshold
+// will be logged at warn level, zero or negative threshold disables the slow sql detection.
+func WithSlowThresholdOpts(threshold time.Duration) DBLoggerOption {
+	return func(dl *DBLogger) {
+		dl.slowThreshold = threshold
+	}
+}
+
+// WithSampleRateOpts sets the fraction of normal (not slow and not failed) statements to log,
+// rates outside (0, 1) log every statement. slow and failed statements are always logged.
+func WithSampleRateOpts(rate float64) DBLoggerOption {
+	return func(dl *DBLogger) {
+		dl.sampleRate = rate
+	}
+}
+
+// WithParamRedactionOpts makes the logger print the sql with placeholders instead of the bound parameters.
+func WithParamRedactionOpts(redact bool) DBLoggerOption {
+	return func(dl *DBLogger) {
+		dl.redactParams = redact
+	}
+}
+
 type DBLogger struct {
-	log logger.Logger
+	log           logger.Logger
+	slowThreshold time.Duration
+	sampleRate    float64
+	redactParams  bool
+	counters      atomic.Pointer[statementCounters]
 }
 
-func NewDBLogger(log logger.Logger) *DBLogger {
-	return &DBLogger{log: log}
+func NewDBLogger(log logger.Logger, opts ...DBLoggerOption) *DBLogger {
+	dl := &DBLogger{log: log}
+	dl.counters.Store(newStatementCounters())
+	for _, opt := range opts {
+		if opt != nil {
+			opt(dl)
+		}
+	}
+
+	return dl
+}
+
+// NewDBLoggerFromOptions creates a DBLogger with the logging settings in the database options.
+func NewDBLoggerFromOptions(options Options) *DBLogger {
+	return NewDBLogger(
+		options.Logger,
+		WithSlowThresholdOpts(options.SlowThreshold),
+		WithSampleRateOpts(options.SqlSampleRate),
+		WithParamRedactionOpts(options.RedactSqlParams),
+	)
+}
+
+// DBLoggerOf returns the DBLogger used by the gorm instance, it can be used to read the sql metrics:
+//
+//	if dl, ok := database.DBLoggerOf(db.GetGormCore(ctx)); ok {
+//		metrics := dl.Metrics()
+//	}
+func DBLoggerOf(db *gorm.DB) (dl *DBLogger, ok bool) {
+	if db == nil {
+		return nil, false
+	}
+
+	dl, ok = db.Logger.(*DBLogger)
+	return dl, ok
 }
 
 func (dl *DBLogger) LogMode(level glog.LogLevel) glog.Interface {
@@ -32,14 +220,63 @@ func (dl *DBLogger) Error(ctx context.Context, s string, i ...interface{}) {
 	dl.log.Errorf(logger.NewFields(ctx), s, i...)
 }
 
+// ParamsFilter implements gorm.ParamsFilter, drops the bound parameters when redaction is enabled,
+// so the traced sql keeps its placeholders.
+func (dl *DBLogger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if dl.redactParams {
+		return sql, nil
+	}
+
+	return sql, params
+}
+
 func (dl *DBLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
 	sql, rows := fc()
+	elapsed := time.Since(begin)
+	slow := dl.slowThreshold > 0 && elapsed > dl.slowThreshold
+	dl.counter(DetectStatementKind(sql)).observe(elapsed, err != nil, slow)
+
 	if err != nil {
-		logMessage := map[string]any{"sql": sql, "error": err.Error(), "rows": rows}
+		logMessage := map[string]any{"sql": sql, "error": err.Error(), "rows": rows, "duration": elapsed.String()}
 		dl.log.Error(logger.NewFields(ctx).WithMessage("tracing sql with error").WithData(logMessage).WithCallTime(begin))
 		return
 	}
 
-	logMessage := map[string]any{"sql": sql, "rows": rows}
+	if slow {
+		logMessage := map[string]any{"sql": sql, "rows": rows, "duration": elapsed.String(), "threshold": dl.slowThreshold.String()}
+		dl.log.Warn(logger.NewFields(ctx).WithMessage("tracing slow sql").WithData(logMessage).WithCallTime(begin))
+		return
+	}
+
+	if dl.sampleRate > 0 && dl.sampleRate < 1 && rand.Float64() >= dl.sampleRate {
+		return
+	}
+
+	logMessage := map[string]any{"sql": sql, "rows": rows, "duration": elapsed.String()}
 	dl.log.Debug(logger.NewFields(ctx).WithMessage("tracing sql").WithData(logMessage).WithCallTime(begin))
 }
+
+// Metrics returns the snapshot of the sql metrics, grouped by statement kind.
+func (dl *DBLogger) Metrics() map[StatementKind]StatementMetrics {
+	metrics := make(map[StatementKind]StatementMetrics, len(statementKinds))
+	for _, kind := range statementKinds {
+		metrics[kind] = dl.counter(kind).export(kind)
+	}
+
+	return metrics
+}
+
+// ResetMetrics clears all collected sql metrics.
+func (dl *DBLogger) ResetMetrics() {
+	dl.counters.Store(newStatementCounters())
+}
+
+func (dl *DBLogger) counter(kind StatementKind) *statementCounter {
+	counters := dl.counters.Load()
+	if counters == nil {
+		dl.counters.CompareAndSwap(nil, newStatementCounters())
+		counters = dl.counters.Load()
+	}
+
+	return (*counters)[kind]
+}
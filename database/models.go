@@ -0,0 +1,44 @@
+package database
+
+import (
+	"reflect"
+	"sync"
+)
+
+var registeredModels = struct {
+	mu     sync.RWMutex
+	types  map[reflect.Type]bool
+	models []any
+}{types: map[reflect.Type]bool{}}
+
+// RegisterModels registers the models of the application, the models migrated by the drivers are registered
+// automatically, so the tools such as the schema drift inspector can find them.
+func RegisterModels(models ...any) {
+	registeredModels.mu.Lock()
+	defer registeredModels.mu.Unlock()
+
+	for _, model := range models {
+		if model == nil {
+			continue
+		}
+
+		modelType := reflect.TypeOf(model)
+		for modelType.Kind() == reflect.Ptr {
+			modelType = modelType.Elem()
+		}
+		if registeredModels.types[modelType] {
+			continue
+		}
+
+		registeredModels.types[modelType] = true
+		registeredModels.models = append(registeredModels.models, model)
+	}
+}
+
+// RegisteredModels returns the registered models in the order of registration.
+func RegisteredModels() []any {
+	registeredModels.mu.RLock()
+	defer registeredModels.mu.RUnlock()
+
+	return append([]any(nil), registeredModels.models...)
+}
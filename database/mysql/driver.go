@@ -13,6 +13,10 @@ import (
 
 const DriverName = "mysql"
 
+func init() {
+	database.RegisterDriver(DriverName, open)
+}
+
 type mysqlDb struct {
 	database.BaseDatabaseImplement
 	database.BaseDatabaseImplementV2
@@ -41,7 +45,10 @@ func (s *mysqlDb) Init(options database.Options) error {
 	if openErr != nil {
 		return fmt.Errorf("open mysqlDb database error: %w", openErr)
 	}
-	db.Logger = database.NewDBLogger(options.Logger)
+	db.Logger = database.NewDBLoggerFromOptions(options)
+	if registerErr := database.RegisterChangeCallbacks(db, options.Logger); registerErr != nil {
+		return fmt.Errorf("register mysqlDb change callbacks error: %w", registerErr)
+	}
 
 	// 设置数据库连接池
 	sqlDb, dbe := db.DB()
@@ -54,6 +61,8 @@ func (s *mysqlDb) Init(options database.Options) error {
 
 	// 连接成功
 	s.BaseDatabaseImplement.Db, s.BaseDatabaseImplementV2.Db = db, db
+	s.BaseDatabaseImplementV2.Timeout = s.BaseDatabaseImplement.Timeout
+	s.BaseDatabaseImplementV2.MaxIdle = options.MaxIdle
 	s.Logger.Info(logger.NewFields().WithMessage("successfully open mysqlDb database").WithData(dataSource))
 
 	// 注册退出事件
@@ -106,3 +115,23 @@ func NewWithLogger(config Config, logger logger.Logger, models ...any) (db datab
 
 	return mysqlDb, nil
 }
+
+// open opens the mysql database for database.Open.
+func open(options database.Options, models ...any) (db database.DatabaseV2, err error) {
+	dsn, convertErr := convertUrlToDataSource(options.DataSource)
+	if convertErr != nil {
+		return nil, convertErr
+	}
+
+	mysqlDb := &mysqlDb{}
+	options.DataSource = dsn
+	if initErr := mysqlDb.Init(options); initErr != nil {
+		return nil, fmt.Errorf("init mysqlDb database error: %w", initErr)
+	}
+
+	if migrateErr := mysqlDb.Migrate(models...); migrateErr != nil {
+		return nil, fmt.Errorf("migrate mysqlDb database error: %w", migrateErr)
+	}
+
+	return mysqlDb, nil
+}
@@ -0,0 +1,49 @@
+package mysql
+
+import (
+	"errors"
+
+	"github.com/alioth-center/infrastructure/database"
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// the error numbers of mysql server, see https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	errLockWaitTimeout   = 1205
+	errDeadlock          = 1213
+	errDuplicateEntry    = 1062
+	errRowIsReferenced   = 1451
+	errNoReferencedRow   = 1452
+	errRowIsReferenced57 = 1217
+	errNoReferencedRow57 = 1216
+	errQueryInterrupted  = 1317
+	errQueryTimeout      = 3024
+)
+
+func init() {
+	database.RegisterErrorClassifier(DriverName, classifyError)
+}
+
+func classifyError(err error) error {
+	var mysqlErr *driver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return nil
+	}
+
+	switch mysqlErr.Number {
+	case errDeadlock:
+		return database.ErrDeadlock
+	case errLockWaitTimeout:
+		return database.ErrLockTimeout
+	case errDuplicateEntry:
+		return database.ErrDuplicateKey
+	case errRowIsReferenced, errNoReferencedRow, errRowIsReferenced57, errNoReferencedRow57:
+		return database.ErrForeignKey
+	case errQueryTimeout:
+		return database.ErrQueryTimeout
+	case errQueryInterrupted:
+		return database.ErrQueryCanceled
+	default:
+		return nil
+	}
+}
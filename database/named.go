@@ -0,0 +1,339 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/alioth-center/infrastructure/utils/concurrency"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidNamedSql       = errors.New("invalid named sql")
+	ErrMissingNamedParameter = errors.New("missing named parameter")
+	ErrEmptyNamedList        = errors.New("empty list for named parameter")
+)
+
+// PlaceholderStyle is the style of the positional placeholders of a driver.
+type PlaceholderStyle int
+
+const (
+	// PlaceholderQuestion renders the placeholders as ?, used by mysql and sqlite.
+	PlaceholderQuestion PlaceholderStyle = iota
+
+	// PlaceholderDollar renders the placeholders as $1, $2 ..., used by postgres.
+	PlaceholderDollar
+)
+
+// PlaceholderStyleOf returns the placeholder style of the driver, such as the name of the gorm dialector.
+func PlaceholderStyleOf(driverName string) PlaceholderStyle {
+	if driverName == "postgres" || driverName == "pgx" {
+		return PlaceholderDollar
+	}
+
+	return PlaceholderQuestion
+}
+
+type namedSegment struct {
+	text     string
+	name     string
+	optional []namedSegment
+}
+
+// NamedSql is a parsed sql template with named parameters, the parameters are written as :name or @name
+// and bound as real driver parameters, which never be substituted into the sql text. Slice parameters
+// are expanded to a list of placeholders for IN conditions, and the part enclosed by [[ and ]] is an
+// optional clause, which is kept only if all the parameters inside are given, not nil and not empty.
+// The named parameters inside quoted strings, quoted identifiers and comments are ignored, and :: casts
+// and @@ system variables are kept as they are. The quotes inside the quoted parts are escaped by doubling
+// them, the backslash escapes of mysql are not recognized.
+//
+// example:
+//
+//	SELECT * FROM users WHERE status = :status [[AND id IN (:ids)]] [[AND name = @name]]
+type NamedSql struct {
+	segments []namedSegment
+}
+
+// namedSqlCacheSize is the max count of the cached templates, the templates built dynamically are parsed
+// every time after the cache is full, instead of growing the cache without bound.
+const namedSqlCacheSize = 1024
+
+var namedSqlCache = concurrency.NewMap[string, *NamedSql]()
+
+// ParseNamedSql parses the template into a NamedSql, the parsed templates are cached by the template text,
+// at most namedSqlCacheSize templates are cached.
+//
+// Parameters:
+//
+//	template (string): The sql template with named parameters.
+//
+// Returns:
+//
+//	named (*NamedSql): The parsed template.
+//	err (error): ErrInvalidNamedSql if the optional clauses are nested or not closed, otherwise nil.
+func ParseNamedSql(template string) (named *NamedSql, err error) {
+	if cached, exist := namedSqlCache.Get(template); exist {
+		return cached, nil
+	}
+
+	segments, rest, parseErr := parseNamedSegments(template, false)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidNamedSql, rest)
+	}
+
+	named = &NamedSql{segments: segments}
+	if namedSqlCache.Length() < namedSqlCacheSize {
+		namedSqlCache.Set(template, named)
+	}
+	return named, nil
+}
+
+// parseNamedSegments parses the template until the end or the close of the optional clause, the
+// unparsed part after the close is returned as rest.
+func parseNamedSegments(template string, inOptional bool) (segments []namedSegment, rest string, err error) {
+	text := strings.Builder{}
+	flush := func() {
+		if text.Len() > 0 {
+			segments = append(segments, namedSegment{text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(template); {
+		c := template[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := skipQuoted(template, i)
+			text.WriteString(template[i:end])
+			i = end
+		case strings.HasPrefix(template[i:], "--"):
+			end := strings.IndexByte(template[i:], '\n')
+			if end < 0 {
+				end = len(template) - i
+			}
+			text.WriteString(template[i : i+end])
+			i += end
+		case strings.HasPrefix(template[i:], "/*"):
+			end := strings.Index(template[i+2:], "*/")
+			if end < 0 {
+				end = len(template) - i - 4
+			}
+			text.WriteString(template[i : i+end+4])
+			i += end + 4
+		case strings.HasPrefix(template[i:], "::") || strings.HasPrefix(template[i:], "@@"):
+			text.WriteString(template[i : i+2])
+			i += 2
+		case (c == ':' || c == '@') && i+1 < len(template) && isNameStart(template[i+1]):
+			end := i + 2
+			for end < len(template) && isNamePart(template[end]) {
+				end++
+			}
+			flush()
+			segments = append(segments, namedSegment{name: template[i+1 : end]})
+			i = end
+		case strings.HasPrefix(template[i:], "[["):
+			if inOptional {
+				return nil, "", fmt.Errorf("%w: nested optional clause", ErrInvalidNamedSql)
+			}
+			flush()
+			optional, optionalRest, optionalErr := parseNamedSegments(template[i+2:], true)
+			if optionalErr != nil {
+				return nil, "", optionalErr
+			}
+			segments = append(segments, namedSegment{optional: optional})
+			template, i = optionalRest, 0
+		case inOptional && strings.HasPrefix(template[i:], "]]"):
+			flush()
+			return segments, template[i+2:], nil
+		default:
+			text.WriteByte(c)
+			i++
+		}
+	}
+
+	if inOptional {
+		return nil, "", fmt.Errorf("%w: optional clause is not closed", ErrInvalidNamedSql)
+	}
+
+	flush()
+	return segments, "", nil
+}
+
+// skipQuoted returns the index after the quoted part starting at start, doubled quotes are treated as escaped,
+// and backslashes are kept as they are like the standard strings of postgres.
+func skipQuoted(template string, start int) int {
+	quote := template[start]
+	for i := start + 1; i < len(template); i++ {
+		if template[i] == quote {
+			if i+1 < len(template) && template[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+
+	return len(template)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// namedValues returns the values of the parameter, slices are expanded except []byte and driver.Valuer.
+func namedValues(value any) (values []any, list bool) {
+	if _, isValuer := value.(driver.Valuer); isValuer {
+		return []any{value}, false
+	}
+	if _, isBytes := value.([]byte); isBytes {
+		return []any{value}, false
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []any{value}, false
+	}
+
+	values = make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+
+	return values, true
+}
+
+// present reports whether all the parameters of the optional clause are given, not nil and not empty.
+func present(segments []namedSegment, params map[string]any) bool {
+	for _, segment := range segments {
+		if segment.name == "" {
+			continue
+		}
+
+		value, exist := params[segment.name]
+		if !exist || value == nil {
+			return false
+		}
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return false
+		}
+		if values, list := namedValues(value); list && len(values) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// render walks the segments with the params, writing the text by write and the values by bind.
+func render(segments []namedSegment, params map[string]any, write func(text string), bind func(value any)) error {
+	for _, segment := range segments {
+		switch {
+		case segment.optional != nil:
+			if present(segment.optional, params) {
+				if err := render(segment.optional, params, write, bind); err != nil {
+					return err
+				}
+			}
+		case segment.name != "":
+			value, exist := params[segment.name]
+			if !exist {
+				return fmt.Errorf("%w: %s", ErrMissingNamedParameter, segment.name)
+			}
+
+			values, list := namedValues(value)
+			if list && len(values) == 0 {
+				return fmt.Errorf("%w: %s", ErrEmptyNamedList, segment.name)
+			}
+			for i, v := range values {
+				if i > 0 {
+					write(", ")
+				}
+				bind(v)
+			}
+		default:
+			write(segment.text)
+		}
+	}
+
+	return nil
+}
+
+// Bind renders the template into sql with the positional placeholders of the style and the arguments in order.
+//
+// Parameters:
+//
+//	params (map[string]any): The values of the named parameters.
+//	style (PlaceholderStyle): The placeholder style of the driver.
+//
+// Returns:
+//
+//	sql (string): The sql with positional placeholders.
+//	args ([]any): The arguments of the placeholders.
+//	err (error): ErrMissingNamedParameter or ErrEmptyNamedList if the params are incomplete, otherwise nil.
+func (n *NamedSql) Bind(params map[string]any, style PlaceholderStyle) (sql string, args []any, err error) {
+	builder := strings.Builder{}
+	err = render(n.segments, params, func(text string) {
+		builder.WriteString(text)
+	}, func(value any) {
+		args = append(args, value)
+		if style == PlaceholderDollar {
+			builder.WriteString("$" + strconv.Itoa(len(args)))
+		} else {
+			builder.WriteByte('?')
+		}
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return builder.String(), args, nil
+}
+
+// Expression binds the params and returns a gorm expression, the placeholders are rendered by the dialector
+// of the statement, and the question marks in the template are never treated as placeholders.
+//
+// example:
+//
+//	expr, err := named.Expression(map[string]any{"ids": []int{1, 2}})
+//	db.Raw("?", expr).Scan(&users)
+func (n *NamedSql) Expression(params map[string]any) (clause.Expression, error) {
+	if err := render(n.segments, params, func(string) {}, func(any) {}); err != nil {
+		return nil, err
+	}
+
+	return namedExpression{segments: n.segments, params: params}, nil
+}
+
+type namedExpression struct {
+	segments []namedSegment
+	params   map[string]any
+}
+
+func (e namedExpression) Build(builder clause.Builder) {
+	_ = render(e.segments, e.params, func(text string) {
+		_, _ = builder.WriteString(text)
+	}, func(value any) {
+		builder.AddVar(builder, value)
+	})
+}
+
+func namedSqlExpression(sql string, params map[string]any) (clause.Expression, error) {
+	named, err := ParseNamedSql(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	return named.Expression(params)
+}
@@ -0,0 +1,134 @@
+// Package outbox implements the transactional outbox pattern: events are stored in the outbox table in
+// the same transaction as the business writes, then a relay worker publishes them to a sink.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alioth-center/infrastructure/trace"
+	"gorm.io/gorm"
+)
+
+const TableName = "outbox_events"
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Event is a row of the outbox table, Payload is the json encoded event body.
+type Event struct {
+	ID            uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Topic         string     `gorm:"column:topic;type:varchar(128)" json:"topic"`
+	Key           string     `gorm:"column:event_key;type:varchar(255)" json:"key"`
+	Payload       string     `gorm:"column:payload;type:text" json:"payload"`
+	Headers       string     `gorm:"column:headers;type:text" json:"headers,omitempty"`
+	TraceID       string     `gorm:"column:trace_id;type:varchar(64)" json:"trace_id"`
+	Status        string     `gorm:"column:status;type:varchar(16);index:idx_outbox_due" json:"status"`
+	Attempts      int        `gorm:"column:attempts" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;index:idx_outbox_due" json:"next_attempt_at"`
+	LastError     string     `gorm:"column:last_error;type:text" json:"last_error,omitempty"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	DeliveredAt   *time.Time `gorm:"column:delivered_at" json:"delivered_at,omitempty"`
+}
+
+func (Event) TableName() string {
+	return TableName
+}
+
+// HeaderMap decodes the headers of the event.
+func (e *Event) HeaderMap() map[string]string {
+	headers := map[string]string{}
+	if e.Headers != "" {
+		_ = json.Unmarshal([]byte(e.Headers), &headers)
+	}
+
+	return headers
+}
+
+var ErrEmptyTopic = errors.New("outbox event topic is empty")
+
+// NewEvent builds a pending event, the payload is encoded as json and the trace id is taken from ctx.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the business operation.
+//	topic (string): The topic of the event.
+//	key (string): The key of the event, such as the id of the changed entity.
+//	payload (any): The body of the event, it will be encoded as json.
+//	headers (map[string]string): Optional headers of the event.
+//
+// Returns:
+//
+//	event (*Event): The pending event.
+//	err (error): An error if the payload cannot be encoded, otherwise nil.
+func NewEvent(ctx context.Context, topic, key string, payload any, headers ...map[string]string) (event *Event, err error) {
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+
+	payloadBytes, marshalErr := json.Marshal(payload)
+	if marshalErr != nil {
+		return nil, fmt.Errorf("marshal outbox payload error: %w", marshalErr)
+	}
+
+	event = &Event{
+		Topic:         topic,
+		Key:           key,
+		Payload:       string(payloadBytes),
+		TraceID:       trace.GetTid(trace.FromContext(ctx)),
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	if len(headers) > 0 && len(headers[0]) > 0 {
+		headerBytes, _ := json.Marshal(headers[0])
+		event.Headers = string(headerBytes)
+	}
+
+	return event, nil
+}
+
+// Store writes the events into the outbox table with the transaction of the business writes, so
+// the events are committed or rolled back together with them.
+//
+// example:
+//
+//	err := db.GetGormCore(ctx).Transaction(func(tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//
+//		event, err := outbox.NewEvent(ctx, "order.created", order.ID, order)
+//		if err != nil {
+//			return err
+//		}
+//
+//		return outbox.Store(tx, event)
+//	})
+func Store(tx *gorm.DB, events ...*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	for _, event := range events {
+		if event.Status == "" {
+			event.Status = StatusPending
+		}
+		if event.NextAttemptAt.IsZero() {
+			event.NextAttemptAt = time.Now()
+		}
+	}
+
+	return tx.Table(TableName).Create(events).Error
+}
+
+// Migrate creates or updates the outbox table.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Event{})
+}
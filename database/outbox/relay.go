@@ -0,0 +1,262 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alioth-center/infrastructure/database"
+	"github.com/alioth-center/infrastructure/exit"
+	"github.com/alioth-center/infrastructure/logger"
+	"github.com/alioth-center/infrastructure/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Option func(r *Relay)
+
+// WithPollIntervalOpts sets the interval between two polling rounds, default is 1 second.
+func WithPollIntervalOpts(interval time.Duration) Option {
+	return func(r *Relay) {
+		if interval > 0 {
+			r.interval = interval
+		}
+	}
+}
+
+// WithBatchSizeOpts sets the max number of events relayed in a polling round, default is 100.
+func WithBatchSizeOpts(size int) Option {
+	return func(r *Relay) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithRetryOpts sets the max attempts of an event and the backoff between attempts, the backoff doubles
+// after every failed attempt until it reaches maxBackoff. Events exceeding max attempts are marked failed.
+func WithRetryOpts(maxAttempts int, baseBackoff, maxBackoff time.Duration) Option {
+	return func(r *Relay) {
+		if maxAttempts > 0 {
+			r.maxAttempts = maxAttempts
+		}
+		if baseBackoff > 0 {
+			r.baseBackoff = baseBackoff
+		}
+		if maxBackoff > 0 {
+			r.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithLeaseOpts sets how long a claimed event is hidden from other relays, if the relay dies
+// before the event is marked, it will be relayed again after the lease expires. default is 1 minute.
+func WithLeaseOpts(lease time.Duration) Option {
+	return func(r *Relay) {
+		if lease > 0 {
+			r.lease = lease
+		}
+	}
+}
+
+// WithLoggerOpts sets the logger of the relay, default is logger.Default().
+func WithLoggerOpts(log logger.Logger) Option {
+	return func(r *Relay) {
+		if log != nil {
+			r.log = log
+		}
+	}
+}
+
+// Relay polls the due events from the outbox table, publishes them via the sink and marks them delivered,
+// the delivery is at least once, so the consumers should be idempotent by the event id.
+type Relay struct {
+	db   database.DatabaseV2
+	sink Sink
+	log  logger.Logger
+
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	lease       time.Duration
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewRelay creates a relay publishing the events of the database to the sink, the outbox table will be migrated.
+//
+// example:
+//
+//	relay, err := outbox.NewRelay(db, outbox.NewLoggerSink(logger.Default()), outbox.WithPollIntervalOpts(time.Second))
+//	relay.Start()
+func NewRelay(db database.DatabaseV2, sink Sink, opts ...Option) (relay *Relay, err error) {
+	relay = &Relay{
+		db:          db,
+		sink:        sink,
+		log:         logger.Default(),
+		interval:    time.Second,
+		batchSize:   100,
+		maxAttempts: 10,
+		baseBackoff: time.Second,
+		maxBackoff:  10 * time.Minute,
+		lease:       time.Minute,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(relay)
+		}
+	}
+
+	if migrateErr := Migrate(db.GetGormCore(context.Background())); migrateErr != nil {
+		return nil, fmt.Errorf("migrate outbox table error: %w", migrateErr)
+	}
+
+	return relay, nil
+}
+
+// Start starts polling in background, the relay stops when Stop is called or the process exits.
+func (r *Relay) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return
+	}
+
+	r.running, r.stop, r.done = true, make(chan struct{}), make(chan struct{})
+	exit.RegisterExitEvent(func(_ os.Signal) {
+		r.Stop()
+		fmt.Println("stopped outbox relay")
+	}, fmt.Sprintf("STOP_OUTBOX_RELAY:%p", r))
+
+	go r.serve(r.stop, r.done)
+}
+
+// Stop stops polling and waits for the current polling round to finish.
+func (r *Relay) Stop() {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = false
+	stop, done := r.stop, r.done
+	r.mu.Unlock()
+
+	close(stop)
+	<-done
+}
+
+func (r *Relay) serve(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		ctx := trace.NewContext()
+		if _, err := r.RelayOnce(ctx); err != nil {
+			r.log.Error(logger.NewFields(ctx).WithMessage("relay outbox events failed").WithData(err.Error()))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce claims a batch of due events, publishes them and marks the results.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the polling round.
+//
+// Returns:
+//
+//	delivered (int): The number of events delivered in this round.
+//	err (error): An error if the events cannot be claimed or marked, otherwise nil.
+func (r *Relay) RelayOnce(ctx context.Context) (delivered int, err error) {
+	events, claimErr := r.claim(ctx)
+	if claimErr != nil {
+		return 0, fmt.Errorf("claim outbox events error: %w", claimErr)
+	}
+
+	for _, event := range events {
+		publishErr := r.sink.Publish(trace.NewContextWithTid(event.TraceID), event)
+		if markErr := r.mark(ctx, event, publishErr); markErr != nil {
+			return delivered, fmt.Errorf("mark outbox event %d error: %w", event.ID, markErr)
+		}
+
+		if publishErr == nil {
+			delivered++
+		} else {
+			r.log.Warn(logger.NewFields(ctx).WithMessage("publish outbox event failed").WithData(map[string]any{
+				"id": event.ID, "topic": event.Topic, "attempts": event.Attempts, "error": publishErr.Error(),
+			}))
+		}
+	}
+
+	return delivered, nil
+}
+
+// claim selects the due events and pushes their next attempt time by the lease, so other relays skip them.
+func (r *Relay) claim(ctx context.Context) (events []*Event, err error) {
+	now := time.Now()
+	err = r.db.GetGormCore(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).Order("id").Limit(r.batchSize)
+		if name := tx.Dialector.Name(); name == "mysql" || name == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked})
+		}
+		if findErr := query.Find(&events).Error; findErr != nil || len(events) == 0 {
+			return findErr
+		}
+
+		ids := make([]uint64, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+
+		return tx.Model(&Event{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(r.lease)).Error
+	})
+
+	return events, err
+}
+
+func (r *Relay) mark(ctx context.Context, event *Event, publishErr error) error {
+	event.Attempts++
+	updates := map[string]any{"attempts": event.Attempts}
+	switch {
+	case publishErr == nil:
+		deliveredAt := time.Now()
+		event.Status, event.DeliveredAt, event.LastError = StatusDelivered, &deliveredAt, ""
+		updates["status"], updates["delivered_at"], updates["last_error"] = event.Status, deliveredAt, ""
+	case event.Attempts >= r.maxAttempts:
+		event.Status, event.LastError = StatusFailed, publishErr.Error()
+		updates["status"], updates["last_error"] = event.Status, event.LastError
+	default:
+		event.NextAttemptAt, event.LastError = time.Now().Add(r.backoff(event.Attempts)), publishErr.Error()
+		updates["next_attempt_at"], updates["last_error"] = event.NextAttemptAt, event.LastError
+	}
+
+	return r.db.GetGormCore(ctx).Model(&Event{}).Where("id = ?", event.ID).Updates(updates).Error
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.baseBackoff
+	for i := 1; i < attempts && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > r.maxBackoff {
+		return r.maxBackoff
+	}
+
+	return delay
+}
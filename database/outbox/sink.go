@@ -0,0 +1,124 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alioth-center/infrastructure/logger"
+	"github.com/alioth-center/infrastructure/network/http"
+	"github.com/go-redis/redis/v8"
+)
+
+// Sink publishes the outbox events to the downstream, returning an error makes the event retried.
+type Sink interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// SinkFunc is an adapter to use a function as a Sink.
+type SinkFunc func(ctx context.Context, event *Event) error
+
+func (fn SinkFunc) Publish(ctx context.Context, event *Event) error {
+	return fn(ctx, event)
+}
+
+// Message is the wire format of the events published by the built-in sinks.
+type Message struct {
+	ID      uint64            `json:"id"`
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key,omitempty"`
+	Payload json.RawMessage   `json:"payload"`
+	Headers map[string]string `json:"headers,omitempty"`
+	TraceID string            `json:"trace_id,omitempty"`
+}
+
+// NewMessage converts the event to the wire format.
+func NewMessage(event *Event) *Message {
+	payload := json.RawMessage(event.Payload)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(event.Payload)
+	}
+
+	return &Message{
+		ID:      event.ID,
+		Topic:   event.Topic,
+		Key:     event.Key,
+		Payload: payload,
+		Headers: event.HeaderMap(),
+		TraceID: event.TraceID,
+	}
+}
+
+type httpSink struct {
+	client http.Client
+	url    string
+}
+
+func (s *httpSink) Publish(ctx context.Context, event *Event) error {
+	request := http.NewRequestBuilder().WithContext(ctx).WithMethod(http.POST).WithPath(s.url).WithJsonBody(NewMessage(event))
+	for key, value := range event.HeaderMap() {
+		request = request.WithHeader(key, value)
+	}
+
+	response, err := s.client.ExecuteRequest(request)
+	if err != nil {
+		return err
+	}
+
+	if code, status := response.Status(); code < 200 || code >= 300 {
+		return fmt.Errorf("publish outbox event to %s failed: %s", s.url, status)
+	}
+
+	return nil
+}
+
+// NewHttpSink creates a sink posting the events as json to the url, non 2xx responses are treated as failures.
+func NewHttpSink(client http.Client, url string) Sink {
+	if client == nil {
+		client = http.NewSimpleClient()
+	}
+
+	return &httpSink{client: client, url: url}
+}
+
+// RedisPublisher is the publishing part of the redis client, *redis.Client satisfies it.
+type RedisPublisher interface {
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+}
+
+type redisSink struct {
+	client RedisPublisher
+	prefix string
+}
+
+func (s *redisSink) Publish(ctx context.Context, event *Event) error {
+	message, err := json.Marshal(NewMessage(event))
+	if err != nil {
+		return fmt.Errorf("marshal outbox message error: %w", err)
+	}
+
+	return s.client.Publish(ctx, s.prefix+event.Topic, message).Err()
+}
+
+// NewRedisSink creates a sink publishing the events to the redis channel named prefix + topic.
+func NewRedisSink(client RedisPublisher, channelPrefix string) Sink {
+	return &redisSink{client: client, prefix: channelPrefix}
+}
+
+type loggerSink struct {
+	log logger.Logger
+}
+
+func (s *loggerSink) Publish(ctx context.Context, event *Event) error {
+	s.log.Info(logger.NewFields(ctx).WithMessage("outbox event published").WithData(NewMessage(event)))
+	return nil
+}
+
+// NewLoggerSink creates a sink writing the events to the logger, it is useful for debugging.
+func NewLoggerSink(log logger.Logger) Sink {
+	if log == nil {
+		log = logger.Default()
+	}
+
+	return &loggerSink{log: log}
+}
@@ -0,0 +1,111 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alioth-center/infrastructure/database/sqlite"
+	"github.com/alioth-center/infrastructure/logger"
+	"github.com/alioth-center/infrastructure/trace"
+	"gorm.io/gorm"
+)
+
+type order struct {
+	ID    int    `gorm:"primaryKey;column:id;autoIncrement"`
+	Title string `gorm:"column:title"`
+}
+
+func TestOutbox(t *testing.T) {
+	db, err := sqlite.NewWithLogger(sqlite.Config{Database: "file:outbox_test?mode=memory&cache=shared"}, logger.Mute(), &order{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts atomic.Int32
+	var received atomic.Value
+	sink := SinkFunc(func(ctx context.Context, event *Event) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("downstream unavailable")
+		}
+
+		received.Store(NewMessage(event))
+		return nil
+	})
+
+	relay, err := NewRelay(db, sink, WithRetryOpts(3, time.Millisecond, 10*time.Millisecond), WithLoggerOpts(logger.Mute()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := trace.NewContext()
+	err = db.GetGormCore(ctx).Transaction(func(tx *gorm.DB) error {
+		if createErr := tx.Create(&order{Title: "rollback"}).Error; createErr != nil {
+			return createErr
+		}
+
+		event, newErr := NewEvent(ctx, "order.created", "rollback", map[string]any{"title": "rollback"})
+		if newErr != nil {
+			return newErr
+		}
+		if storeErr := Store(tx, event); storeErr != nil {
+			return storeErr
+		}
+
+		return errors.New("rollback the business write")
+	})
+	if err == nil {
+		t.Fatal("expected transaction to be rolled back")
+	}
+
+	err = db.GetGormCore(ctx).Transaction(func(tx *gorm.DB) error {
+		created := &order{Title: "commit"}
+		if createErr := tx.Create(created).Error; createErr != nil {
+			return createErr
+		}
+
+		event, newErr := NewEvent(ctx, "order.created", "commit", created, map[string]string{"source": "test"})
+		if newErr != nil {
+			return newErr
+		}
+
+		return Store(tx, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered, relayErr := relay.RelayOnce(ctx); relayErr != nil || delivered != 0 {
+		t.Fatalf("expected first attempt to fail, delivered %d, error %v", delivered, relayErr)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if delivered, relayErr := relay.RelayOnce(ctx); relayErr != nil || delivered != 1 {
+		t.Fatalf("expected event to be delivered on retry, delivered %d, error %v", delivered, relayErr)
+	}
+
+	message, _ := received.Load().(*Message)
+	if message == nil || message.Key != "commit" || message.Headers["source"] != "test" || message.TraceID != trace.GetTid(ctx) {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+
+	var events []Event
+	if err = db.GetGormCore(ctx).Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Status != StatusDelivered || events[0].Attempts != 2 || events[0].DeliveredAt == nil {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	relay.Start()
+	relay.Stop()
+
+	if _, err = NewEvent(ctx, "", "", nil); !errors.Is(err, ErrEmptyTopic) {
+		t.Fatalf("expected empty topic error, got %v", err)
+	}
+	if backoff := relay.backoff(10); backoff != 10*time.Millisecond {
+		t.Fatalf("expected backoff to be capped, got %s", backoff)
+	}
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alioth-center/infrastructure/exit"
+	"github.com/alioth-center/infrastructure/logger"
+	"github.com/alioth-center/infrastructure/trace"
+	"gorm.io/gorm"
+)
+
+// defaultMaxIdleConns is the default max idle connections of database/sql.
+const defaultMaxIdleConns = 2
+
+// PoolStats is the statistics of the connection pool, MaxIdle is the configured Options.MaxIdle, it is 0 if the
+// pool is not opened by the drivers, such as the gorm instances passed to GetPoolStats.
+type PoolStats struct {
+	MaxOpen           int           `json:"max_open"`
+	MaxIdle           int           `json:"max_idle"`
+	Open              int           `json:"open"`
+	InUse             int           `json:"in_use"`
+	Idle              int           `json:"idle"`
+	WaitCount         int64         `json:"wait_count"`
+	WaitDuration      time.Duration `json:"wait_duration"`
+	MaxIdleClosed     int64         `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64         `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64         `json:"max_lifetime_closed"`
+}
+
+// Saturation returns the fraction of the in-use connections to the max open connections,
+// it is always 0 if the max open connections is unlimited.
+func (s PoolStats) Saturation() float64 {
+	if s.MaxOpen <= 0 {
+		return 0
+	}
+
+	return float64(s.InUse) / float64(s.MaxOpen)
+}
+
+func newPoolStats(stats sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpen:           stats.MaxOpenConnections,
+		Open:              stats.OpenConnections,
+		InUse:             stats.InUse,
+		Idle:              stats.Idle,
+		WaitCount:         stats.WaitCount,
+		WaitDuration:      stats.WaitDuration,
+		MaxIdleClosed:     stats.MaxIdleClosed,
+		MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed: stats.MaxLifetimeClosed,
+	}
+}
+
+// HealthCheck pings the database of the gorm instance.
+func HealthCheck(ctx context.Context, db *gorm.DB) error {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("get sql database error: %w", err)
+	}
+
+	if pingErr := sqlDb.PingContext(ctx); pingErr != nil {
+		return fmt.Errorf("ping database error: %w", pingErr)
+	}
+
+	return nil
+}
+
+// GetPoolStats returns the statistics of the connection pool of the gorm instance, it returns the
+// zero stats if the connection pool of the instance is not a *sql.DB, such as in a transaction.
+func GetPoolStats(db *gorm.DB) PoolStats {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return PoolStats{}
+	}
+
+	return newPoolStats(sqlDb.Stats())
+}
+
+type PoolMonitorOption func(m *PoolMonitor)
+
+// WithMonitorIntervalOpts sets the interval between two checks, default is 10 seconds.
+func WithMonitorIntervalOpts(interval time.Duration) PoolMonitorOption {
+	return func(m *PoolMonitor) {
+		if interval > 0 {
+			m.interval = interval
+		}
+	}
+}
+
+// WithMonitorTimeoutOpts sets the timeout of the ping, default is 3 seconds.
+func WithMonitorTimeoutOpts(timeout time.Duration) PoolMonitorOption {
+	return func(m *PoolMonitor) {
+		if timeout > 0 {
+			m.timeout = timeout
+		}
+	}
+}
+
+// WithSaturationThresholdOpts sets the saturation above which the pool is logged as saturated, default is 0.8.
+func WithSaturationThresholdOpts(threshold float64) PoolMonitorOption {
+	return func(m *PoolMonitor) {
+		if threshold > 0 {
+			m.saturation = threshold
+		}
+	}
+}
+
+// WithMonitorMaxIdleOpts sets the max idle connections restored after the idle connections are flushed, default
+// is the PoolStats.MaxIdle of the database, which is Options.MaxIdle, or 2 of database/sql if it is not set.
+func WithMonitorMaxIdleOpts(maxIdle int) PoolMonitorOption {
+	return func(m *PoolMonitor) {
+		if maxIdle > 0 {
+			m.maxIdle = maxIdle
+		}
+	}
+}
+
+// WithMonitorLoggerOpts sets the logger of the monitor, default is logger.Default().
+func WithMonitorLoggerOpts(log logger.Logger) PoolMonitorOption {
+	return func(m *PoolMonitor) {
+		if log != nil {
+			m.log = log
+		}
+	}
+}
+
+// PoolMonitor checks the database periodically, it logs the pool saturation and the failures, and flushes
+// the idle connections after a failure, so the pool reconnects with new connections when the database is back.
+type PoolMonitor struct {
+	db  DatabaseV2
+	log logger.Logger
+
+	interval   time.Duration
+	timeout    time.Duration
+	saturation float64
+	maxIdle    int
+
+	healthy  atomic.Bool
+	failures atomic.Int64
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewPoolMonitor creates a monitor of the database, call Start to run it in background.
+//
+// example:
+//
+//	monitor := database.NewPoolMonitor(db, database.WithMonitorIntervalOpts(5*time.Second))
+//	monitor.Start()
+//	ready := monitor.Healthy()
+func NewPoolMonitor(db DatabaseV2, opts ...PoolMonitorOption) *PoolMonitor {
+	monitor := &PoolMonitor{
+		db:         db,
+		log:        logger.Default(),
+		interval:   10 * time.Second,
+		timeout:    3 * time.Second,
+		saturation: 0.8,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(monitor)
+		}
+	}
+
+	monitor.healthy.Store(true)
+	return monitor
+}
+
+// Healthy returns the result of the last check, it is true before the first check.
+func (m *PoolMonitor) Healthy() bool {
+	return m.healthy.Load()
+}
+
+// Start starts checking in background, the monitor stops when Stop is called or the process exits.
+func (m *PoolMonitor) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running {
+		return
+	}
+
+	m.running, m.stop, m.done = true, make(chan struct{}), make(chan struct{})
+	exit.RegisterExitEvent(func(_ os.Signal) {
+		m.Stop()
+		fmt.Println("stopped database pool monitor")
+	}, fmt.Sprintf("STOP_DATABASE_POOL_MONITOR:%p", m))
+
+	go m.serve(m.stop, m.done)
+}
+
+// Stop stops checking and waits for the current check to finish.
+func (m *PoolMonitor) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	stop, done := m.stop, m.done
+	m.mu.Unlock()
+
+	close(stop)
+	<-done
+}
+
+func (m *PoolMonitor) serve(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.Check(trace.NewContext())
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check pings the database and inspects the pool once, it is called periodically after Start.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the check.
+//
+// Returns:
+//
+//	stats (PoolStats): The statistics of the connection pool.
+//	err (error): The error of the ping, nil if the database is healthy.
+func (m *PoolMonitor) Check(ctx context.Context) (stats PoolStats, err error) {
+	pingCtx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	err = m.db.HealthCheck(pingCtx)
+	stats = m.db.PoolStats()
+	if err != nil {
+		failures := m.failures.Add(1)
+		m.healthy.Store(false)
+		m.flushIdle(ctx, stats)
+		m.log.Error(logger.NewFields(ctx).WithMessage("database health check failed").WithData(map[string]any{
+			"error": err.Error(), "failures": failures, "stats": stats,
+		}))
+		return stats, err
+	}
+
+	if failures := m.failures.Swap(0); failures > 0 {
+		m.log.Info(logger.NewFields(ctx).WithMessage("database recovered").WithData(map[string]any{
+			"failures": failures, "stats": stats,
+		}))
+	}
+	m.healthy.Store(true)
+
+	if saturation := stats.Saturation(); saturation >= m.saturation {
+		m.log.Warn(logger.NewFields(ctx).WithMessage("database connection pool saturated").WithData(map[string]any{
+			"saturation": saturation, "stats": stats,
+		}))
+	}
+
+	return stats, nil
+}
+
+// flushIdle closes the idle connections which may be broken, the new connections are dialed on demand. The max
+// idle connections are restored to the configured ones after the flush.
+func (m *PoolMonitor) flushIdle(ctx context.Context, stats PoolStats) {
+	sqlDb, err := m.db.GetGormCore(ctx).DB()
+	if err != nil {
+		return
+	}
+
+	maxIdle := m.maxIdle
+	if maxIdle <= 0 {
+		maxIdle = stats.MaxIdle
+	}
+	if maxIdle <= 0 {
+		maxIdle = defaultMaxIdleConns
+	}
+
+	sqlDb.SetMaxIdleConns(0)
+	sqlDb.SetMaxIdleConns(maxIdle)
+}
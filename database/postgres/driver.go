@@ -13,6 +13,12 @@ import (
 
 const DriverName = "postgres"
 
+func init() {
+	// the urls are passed to pgx as they are, it accepts both postgres:// and postgresql://
+	database.RegisterDriver(DriverName, open)
+	database.RegisterDriver("postgresql", open)
+}
+
 type postgresDb struct {
 	database.BaseDatabaseImplement
 	database.BaseDatabaseImplementV2
@@ -41,7 +47,10 @@ func (s *postgresDb) Init(options database.Options) error {
 	if openErr != nil {
 		return fmt.Errorf("open postgresDb database error: %w", openErr)
 	}
-	db.Logger = database.NewDBLogger(options.Logger)
+	db.Logger = database.NewDBLoggerFromOptions(options)
+	if registerErr := database.RegisterChangeCallbacks(db, options.Logger); registerErr != nil {
+		return fmt.Errorf("register postgresDb change callbacks error: %w", registerErr)
+	}
 
 	// 设置数据库连接池
 	sqlDb, dbe := db.DB()
@@ -54,6 +63,8 @@ func (s *postgresDb) Init(options database.Options) error {
 
 	// 连接成功
 	s.BaseDatabaseImplement.Db, s.BaseDatabaseImplementV2.Db = db, db
+	s.BaseDatabaseImplementV2.Timeout = s.BaseDatabaseImplement.Timeout
+	s.BaseDatabaseImplementV2.MaxIdle = options.MaxIdle
 	s.Logger.Info(logger.NewFields().WithMessage("successfully open postgresDb database").WithData(dataSource))
 
 	// 注册退出事件
@@ -106,3 +117,17 @@ func NewWithLogger(config Config, logger logger.Logger, models ...any) (db datab
 
 	return postgresDb, nil
 }
+
+// open opens the postgres database for database.Open.
+func open(options database.Options, models ...any) (db database.DatabaseV2, err error) {
+	postgresDb := &postgresDb{}
+	if initErr := postgresDb.Init(options); initErr != nil {
+		return nil, fmt.Errorf("init postgresDb database error: %w", initErr)
+	}
+
+	if migrateErr := postgresDb.Migrate(models...); migrateErr != nil {
+		return nil, fmt.Errorf("migrate postgresDb database error: %w", migrateErr)
+	}
+
+	return postgresDb, nil
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/alioth-center/infrastructure/database"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// the sql states of postgres, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	stateUniqueViolation      = "23505"
+	stateForeignKeyViolation  = "23503"
+	stateSerializationFailure = "40001"
+	stateDeadlockDetected     = "40P01"
+	stateLockNotAvailable     = "55P03"
+	stateQueryCanceled        = "57014"
+)
+
+func init() {
+	database.RegisterErrorClassifier(DriverName, classifyError)
+}
+
+func classifyError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	switch pgErr.Code {
+	case stateDeadlockDetected:
+		return database.ErrDeadlock
+	case stateSerializationFailure:
+		return database.ErrSerialization
+	case stateLockNotAvailable:
+		return database.ErrLockTimeout
+	case stateUniqueViolation:
+		return database.ErrDuplicateKey
+	case stateForeignKeyViolation:
+		return database.ErrForeignKey
+	case stateQueryCanceled:
+		// the statement_timeout and the cancel requests share the state, only the message tells them apart
+		if strings.Contains(pgErr.Message, "statement timeout") {
+			return database.ErrQueryTimeout
+		}
+		return database.ErrQueryCanceled
+	default:
+		return nil
+	}
+}
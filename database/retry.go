@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/alioth-center/infrastructure/utils/values"
+	"gorm.io/gorm"
+)
+
+// The kinds of the classified errors, the errors returned by the DatabaseV2 methods can be checked by errors.Is,
+// and the original driver error is kept in the chain, so errors.As can still be used to get the driver error.
+var (
+	ErrDuplicateKey  = errors.New("duplicate key")
+	ErrForeignKey    = errors.New("foreign key violation")
+	ErrNotFound      = errors.New("record not found")
+	ErrDeadlock      = errors.New("deadlock detected")
+	ErrLockTimeout   = errors.New("lock wait timeout")
+	ErrSerialization = errors.New("serialization failure")
+	ErrQueryTimeout  = errors.New("query timeout")
+	ErrQueryCanceled = errors.New("query canceled")
+)
+
+// ClassifiedError is a driver error with its kind.
+type ClassifiedError struct {
+	Kind error
+	Err  error
+}
+
+func (e *ClassifiedError) Error() string {
+	return values.BuildStrings(e.Kind.Error(), ": ", e.Err.Error())
+}
+
+func (e *ClassifiedError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// ErrorClassifier returns the kind of the driver error, such as ErrDeadlock, nil if the error is unknown to it.
+type ErrorClassifier func(err error) (kind error)
+
+var (
+	errorClassifiers   = map[string]ErrorClassifier{}
+	errorClassifiersMu sync.RWMutex
+)
+
+// RegisterErrorClassifier registers the error classifier of the driver, the drivers register their
+// classifiers when imported, registering with the same name replaces the previous one.
+func RegisterErrorClassifier(driverName string, classifier ErrorClassifier) {
+	errorClassifiersMu.Lock()
+	defer errorClassifiersMu.Unlock()
+
+	if classifier == nil {
+		delete(errorClassifiers, driverName)
+		return
+	}
+
+	errorClassifiers[driverName] = classifier
+}
+
+// ClassifyError wraps the error with its kind by the registered classifiers, the error is returned
+// as it is if it is nil, already classified or unknown to the classifiers.
+//
+// example:
+//
+//	if err := database.ClassifyError(tx.Create(&user).Error); errors.Is(err, database.ErrDuplicateKey) {
+//		return ErrUserExists
+//	}
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &ClassifiedError{Kind: ErrNotFound, Err: err}
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return &ClassifiedError{Kind: ErrDuplicateKey, Err: err}
+	}
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		return &ClassifiedError{Kind: ErrForeignKey, Err: err}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &ClassifiedError{Kind: ErrQueryTimeout, Err: err}
+	}
+	if errors.Is(err, context.Canceled) {
+		return &ClassifiedError{Kind: ErrQueryCanceled, Err: err}
+	}
+
+	errorClassifiersMu.RLock()
+	defer errorClassifiersMu.RUnlock()
+	for _, classifier := range errorClassifiers {
+		if kind := classifier(err); kind != nil {
+			return &ClassifiedError{Kind: kind, Err: err}
+		}
+	}
+
+	return err
+}
+
+// IsTransientError reports whether the error is a deadlock, a lock wait timeout or a serialization failure,
+// which may succeed if retried.
+func IsTransientError(err error) bool {
+	err = ClassifyError(err)
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrLockTimeout) || errors.Is(err, ErrSerialization)
+}
+
+// RetryPolicy is the policy to retry the transient errors, the delay before the nth retry is
+// BaseDelay * 2^(n-1), capped by MaxDelay, and randomized by ±Jitter of itself.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+
+	// Retryable decides whether the error should be retried, default is IsTransientError.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy returns the policy attempting 3 times, waiting from 20ms to 1s with 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, BaseDelay: 20 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.2}
+}
+
+// Delay returns the delay before the retry after the attempt, the attempt starts from 1.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		delta := float64(delay) * p.Jitter
+		delay += time.Duration(delta*2*rand.Float64() - delta)
+	}
+
+	return delay
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return IsTransientError(err)
+}
+
+// Retry calls fn until it succeeds, returns an error which is not retryable, the attempts are exhausted
+// or the context is done. fn should be idempotent, the returned error is classified.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the operation, waiting is interrupted when it is done.
+//	policy (RetryPolicy): The retry policy.
+//	fn (func(ctx context.Context) error): The operation to retry.
+//
+// Returns:
+//
+//	err (error): The classified error of the last attempt, or the context error, nil if succeeded.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = ClassifyError(fn(ctx))
+		if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(policy.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// TransactionWithRetry runs fn in a transaction, the whole transaction is retried by the policy if it
+// fails with a retryable error, such as a deadlock, so fn should not have side effects out of the transaction.
+//
+// example:
+//
+//	err := database.TransactionWithRetry(ctx, db, database.DefaultRetryPolicy(), func(tx *gorm.DB) error {
+//		return tx.Model(&Account{}).Where("id = ?", id).Update("balance", gorm.Expr("balance - ?", amount)).Error
+//	})
+func TransactionWithRetry(ctx context.Context, db DatabaseV2, policy RetryPolicy, fn func(tx *gorm.DB) error) error {
+	return Retry(ctx, policy, func(ctx context.Context) error {
+		return db.Transaction(ctx, fn)
+	})
+}
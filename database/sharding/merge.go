@@ -0,0 +1,162 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// mergeSorted merges the sorted results of the shards into one sorted slice, the results are
+// concatenated in shard order if the order column is empty.
+func mergeSorted(ctx context.Context, db *gorm.DB, results []reflect.Value, order string, desc bool) reflect.Value {
+	total := 0
+	for _, result := range results {
+		total += result.Len()
+	}
+
+	merged := reflect.MakeSlice(results[0].Type(), 0, total)
+	if order == "" {
+		for _, result := range results {
+			merged = reflect.AppendSlice(merged, result)
+		}
+		return merged
+	}
+
+	orderOf := orderValueFunc(ctx, db, results[0].Type().Elem(), order)
+	heads := make([]int, len(results))
+	for merged.Len() < total {
+		picked := -1
+		for i, result := range results {
+			if heads[i] >= result.Len() {
+				continue
+			}
+			if picked < 0 {
+				picked = i
+				continue
+			}
+
+			cmp := compare(orderOf(result.Index(heads[i])), orderOf(results[picked].Index(heads[picked])))
+			if (!desc && cmp < 0) || (desc && cmp > 0) {
+				picked = i
+			}
+		}
+
+		merged = reflect.Append(merged, results[picked].Index(heads[picked]))
+		heads[picked]++
+	}
+
+	return merged
+}
+
+// orderValueFunc returns the function reading the order column of an element, the element can be a
+// struct, a pointer to struct or a map[string]any.
+func orderValueFunc(ctx context.Context, db *gorm.DB, elemType reflect.Type, order string) func(elem reflect.Value) any {
+	structType := elemType
+	for structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+
+	if structType.Kind() == reflect.Struct {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(reflect.New(structType).Interface()); err == nil {
+			if field := stmt.Schema.LookUpField(order); field != nil {
+				return func(elem reflect.Value) any {
+					elem = reflect.Indirect(elem)
+					if !elem.IsValid() {
+						return nil
+					}
+
+					value, _ := field.ValueOf(ctx, elem)
+					return value
+				}
+			}
+		}
+	}
+
+	return func(elem reflect.Value) any {
+		if row, ok := reflect.Indirect(elem).Interface().(map[string]any); ok {
+			return row[order]
+		}
+
+		return nil
+	}
+}
+
+// compare compares the values of the same column, nil is the smallest.
+func compare(a, b any) int {
+	a, b = indirect(a), indirect(b)
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isInt(ra) && isInt(rb):
+		return compareOrdered(ra.Int(), rb.Int())
+	case isUint(ra) && isUint(rb):
+		return compareOrdered(ra.Uint(), rb.Uint())
+	case isNumber(ra) && isNumber(rb):
+		return compareOrdered(toFloat(ra), toFloat(rb))
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+func isUint(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+func isNumber(v reflect.Value) bool {
+	return isInt(v) || isUint(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case isInt(v):
+		return float64(v.Int())
+	case isUint(v):
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
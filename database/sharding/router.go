@@ -0,0 +1,355 @@
+// Package sharding routes the operations of a table split across several databases by a shard key.
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/alioth-center/infrastructure/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrNoShards              = errors.New("no shards for the router")
+	ErrInvalidStrategy       = errors.New("invalid sharding strategy")
+	ErrShardNotFound         = errors.New("shard not found")
+	ErrInvalidShardKey       = errors.New("invalid shard key")
+	ErrShardKeyRequired      = errors.New("shard key is required to route the operation")
+	ErrCrossShardTransaction = errors.New("transaction across shards is not supported")
+	ErrInvalidReceiver       = errors.New("receiver must be a pointer to slice for scatter-gather")
+)
+
+// Router holds the shards of a table and routes the operations to them by the shard key. The operations
+// carrying the shard key in the data or the condition go to one shard, List and Count without it are
+// scattered to all shards and gathered, and the other operations without it are rejected.
+//
+// Router does not implement database.DatabaseV2 on purpose, because the operations across shards are
+// not atomic, use Shard or Transaction to operate a single shard directly.
+type Router struct {
+	shards   []database.DatabaseV2
+	strategy Strategy
+	column   string
+}
+
+// NewRouter creates a router of the shards, the shard key is the value of the column.
+//
+// example:
+//
+//	router, err := sharding.NewRouter("user_id", sharding.HashStrategy(), shard0, shard1, shard2)
+//	err = router.CreateSingleDataIfNotExist(ctx, &Order{UserID: 42, Title: "book"})
+//	err = router.ListDataWithPage(ctx, &orders, map[string]any{"status": 1}, "created_at", true, 0, 20)
+func NewRouter(column string, strategy Strategy, shards ...database.DatabaseV2) (router *Router, err error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+	if column == "" || strategy == nil {
+		return nil, ErrInvalidStrategy
+	}
+
+	return &Router{shards: shards, strategy: strategy, column: column}, nil
+}
+
+// Shards returns all the shards, such as for migrating them.
+func (r *Router) Shards() []database.DatabaseV2 {
+	return append([]database.DatabaseV2(nil), r.shards...)
+}
+
+// ShardIndex returns the index of the shard holding the key.
+func (r *Router) ShardIndex(key any) (index int, err error) {
+	if indirect(key) == nil {
+		return 0, fmt.Errorf("%w: nil", ErrInvalidShardKey)
+	}
+
+	index, err = r.strategy.Shard(key, len(r.shards))
+	if err != nil {
+		return 0, err
+	}
+	if index < 0 || index >= len(r.shards) {
+		return 0, fmt.Errorf("%w: index %d out of %d shards", ErrShardNotFound, index, len(r.shards))
+	}
+
+	return index, nil
+}
+
+// Shard returns the shard holding the key.
+func (r *Router) Shard(key any) (shard database.DatabaseV2, err error) {
+	index, err := r.ShardIndex(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.shards[index], nil
+}
+
+// keyOf extracts the shard key from a map or a struct, found is false if the key is absent or zero.
+func (r *Router) keyOf(ctx context.Context, value any) (key any, found bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		key, found = v[r.column]
+		return key, found && indirect(key) != nil
+	case *map[string]any:
+		return r.keyOf(ctx, *v)
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	field := r.field(ctx, rv.Type())
+	if field == nil {
+		return nil, false
+	}
+
+	key, isZero := field.ValueOf(ctx, rv)
+	return key, !isZero
+}
+
+func (r *Router) field(ctx context.Context, modelType reflect.Type) *schema.Field {
+	stmt := &gorm.Statement{DB: r.shards[0].GetGormCore(ctx)}
+	if err := stmt.Parse(reflect.New(modelType).Interface()); err != nil {
+		return nil
+	}
+
+	return stmt.Schema.LookUpField(r.column)
+}
+
+// route returns the shard by the key found in the first candidate having it.
+func (r *Router) route(ctx context.Context, candidates ...any) (shard database.DatabaseV2, err error) {
+	for _, candidate := range candidates {
+		if key, found := r.keyOf(ctx, candidate); found {
+			return r.Shard(key)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: column %s", ErrShardKeyRequired, r.column)
+}
+
+// routeSingle returns the shard by the single column condition, or by the candidates if the column is not the key.
+func (r *Router) routeSingle(ctx context.Context, column string, condition any, candidates ...any) (shard database.DatabaseV2, err error) {
+	if column == r.column && !database.FromSlice(condition) {
+		return r.Shard(condition)
+	}
+
+	return r.route(ctx, candidates...)
+}
+
+// scatter calls fn on all shards concurrently and joins the errors.
+func (r *Router) scatter(fn func(index int, shard database.DatabaseV2) error) error {
+	errs := make([]error, len(r.shards))
+	wg := sync.WaitGroup{}
+	for i, shard := range r.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(i, shard); err != nil {
+				errs[i] = fmt.Errorf("shard %d: %w", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// GetDataBySingleCondition retrieves data from the shard of the condition, the column must be the shard key.
+func (r *Router) GetDataBySingleCondition(ctx context.Context, receiver any, column string, condition any, needFields ...string) error {
+	shard, err := r.routeSingle(ctx, column, condition)
+	if err != nil {
+		return err
+	}
+
+	return shard.GetDataBySingleCondition(ctx, receiver, column, condition, needFields...)
+}
+
+// GetDataByCustomCondition retrieves data from the shard of the condition, the condition must carry the shard key.
+func (r *Router) GetDataByCustomCondition(ctx context.Context, receiver, condition any, needFields ...string) error {
+	shard, err := r.route(ctx, condition)
+	if err != nil {
+		return err
+	}
+
+	return shard.GetDataByCustomCondition(ctx, receiver, condition, needFields...)
+}
+
+// ListDataWithPage retrieves a page of data, from the shard of the filter if it carries the shard key,
+// otherwise from all shards, the results are merge-sorted by the order column before paging, so the
+// order column should be selected if needFields is given.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for the database operation.
+//	receiver (any): The pointer to slice where the query result will be stored.
+//	filter (any): The filter condition for the query.
+//	order (string): The column name to order by.
+//	desc (bool): Whether to order in descending order.
+//	offset (int): The page index for pagination, as database.DatabaseV2 does.
+//	limit (int): The page size for pagination.
+//	needFields (...string): Optional fields to select in the query.
+//
+// Returns:
+//
+//	error: An error if any shard fails, otherwise nil.
+func (r *Router) ListDataWithPage(ctx context.Context, receiver any, filter any, order string, desc bool, offset, limit int, needFields ...string) error {
+	if shard, routeErr := r.route(ctx, filter); routeErr == nil {
+		return shard.ListDataWithPage(ctx, receiver, filter, order, desc, offset, limit, needFields...)
+	}
+
+	target := reflect.ValueOf(receiver)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Slice {
+		return ErrInvalidReceiver
+	}
+
+	// every shard may hold the whole page, so each shard returns the rows up to the end of the page
+	results := make([]reflect.Value, len(r.shards))
+	err := r.scatter(func(index int, shard database.DatabaseV2) error {
+		result := reflect.New(target.Elem().Type())
+		results[index] = result.Elem()
+		return shard.ListDataWithPage(ctx, result.Interface(), filter, order, desc, 0, (offset+1)*limit, needFields...)
+	})
+	if err != nil {
+		return err
+	}
+
+	merged := mergeSorted(ctx, r.shards[0].GetGormCore(ctx), results, order, desc)
+	start, end := min(offset*limit, merged.Len()), min((offset+1)*limit, merged.Len())
+	target.Elem().Set(merged.Slice(start, end))
+	return nil
+}
+
+// CountData counts the rows of the model matching the condition, in the shard of the condition if it
+// carries the shard key, otherwise in all shards.
+func (r *Router) CountData(ctx context.Context, model, condition any) (count int64, err error) {
+	if shard, routeErr := r.route(ctx, condition); routeErr == nil {
+		err = shard.GetGormCore(ctx).Model(model).Where(condition).Count(&count).Error
+		return count, database.ClassifyError(err)
+	}
+
+	counts := make([]int64, len(r.shards))
+	err = r.scatter(func(index int, shard database.DatabaseV2) error {
+		return database.ClassifyError(shard.GetGormCore(ctx).Model(model).Where(condition).Count(&counts[index]).Error)
+	})
+	for _, shardCount := range counts {
+		count += shardCount
+	}
+
+	return count, err
+}
+
+// CreateSingleDataIfNotExist creates the data in the shard of its shard key.
+func (r *Router) CreateSingleDataIfNotExist(ctx context.Context, data any) (created bool, err error) {
+	shard, err := r.route(ctx, data)
+	if err != nil {
+		return false, err
+	}
+
+	return shard.CreateSingleDataIfNotExist(ctx, data)
+}
+
+// CreateDataOnDuplicateKeyUpdate creates or updates the data in the shard of its shard key, a slice of data
+// is grouped by the shards, the groups are not written atomically.
+func (r *Router) CreateDataOnDuplicateKeyUpdate(ctx context.Context, data any, indexKeys, updateFields []string) error {
+	rows := reflect.Indirect(reflect.ValueOf(data))
+	if rows.Kind() != reflect.Slice && rows.Kind() != reflect.Array {
+		shard, err := r.route(ctx, data)
+		if err != nil {
+			return err
+		}
+
+		return shard.CreateDataOnDuplicateKeyUpdate(ctx, data, indexKeys, updateFields)
+	}
+
+	groups := map[int]reflect.Value{}
+	for i := 0; i < rows.Len(); i++ {
+		key, found := r.keyOf(ctx, rows.Index(i).Interface())
+		if !found {
+			return fmt.Errorf("%w: column %s of row %d", ErrShardKeyRequired, r.column, i)
+		}
+
+		index, err := r.ShardIndex(key)
+		if err != nil {
+			return err
+		}
+		if _, exist := groups[index]; !exist {
+			groups[index] = reflect.MakeSlice(reflect.SliceOf(rows.Type().Elem()), 0, rows.Len())
+		}
+		groups[index] = reflect.Append(groups[index], rows.Index(i))
+	}
+
+	return r.scatter(func(index int, shard database.DatabaseV2) error {
+		group, exist := groups[index]
+		if !exist {
+			return nil
+		}
+
+		return shard.CreateDataOnDuplicateKeyUpdate(ctx, group.Interface(), indexKeys, updateFields)
+	})
+}
+
+// UpdateDataBySingleCondition updates the data in the shard of the condition if the column is the shard key,
+// otherwise in the shard of the shard key carried by the updates.
+func (r *Router) UpdateDataBySingleCondition(ctx context.Context, updates any, column string, condition any) error {
+	shard, err := r.routeSingle(ctx, column, condition, updates)
+	if err != nil {
+		return err
+	}
+
+	return shard.UpdateDataBySingleCondition(ctx, updates, column, condition)
+}
+
+// UpdateDataByCustomCondition updates the data in the shard of the shard key carried by the condition or the updates.
+func (r *Router) UpdateDataByCustomCondition(ctx context.Context, updates, condition any) error {
+	shard, err := r.route(ctx, condition, updates)
+	if err != nil {
+		return err
+	}
+
+	return shard.UpdateDataByCustomCondition(ctx, updates, condition)
+}
+
+// SoftDeleteData soft deletes the data in the shard of the shard key carried by the condition.
+func (r *Router) SoftDeleteData(ctx context.Context, model, condition any) error {
+	shard, err := r.route(ctx, condition)
+	if err != nil {
+		return err
+	}
+
+	return shard.SoftDeleteData(ctx, model, condition)
+}
+
+// Transaction runs fn in a transaction of the shard holding all the keys, it fails with
+// ErrCrossShardTransaction if the keys belong to different shards.
+//
+// example:
+//
+//	err := router.Transaction(ctx, []any{order.UserID, payment.UserID}, func(tx *gorm.DB) error {
+//		return tx.Create(&order).Error
+//	})
+func (r *Router) Transaction(ctx context.Context, keys []any, fn func(tx *gorm.DB) error) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: column %s", ErrShardKeyRequired, r.column)
+	}
+
+	index, err := r.ShardIndex(keys[0])
+	if err != nil {
+		return err
+	}
+	for _, key := range keys[1:] {
+		other, indexErr := r.ShardIndex(key)
+		if indexErr != nil {
+			return indexErr
+		}
+		if other != index {
+			return fmt.Errorf("%w: keys %v and %v are in shard %d and %d", ErrCrossShardTransaction, keys[0], key, index, other)
+		}
+	}
+
+	return r.shards[index].Transaction(ctx, fn)
+}
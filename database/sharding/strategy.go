@@ -0,0 +1,132 @@
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Strategy maps the shard key to the index of the shard.
+type Strategy interface {
+	Shard(key any, shards int) (index int, err error)
+}
+
+// StrategyFunc is an adapter to use a function as a Strategy.
+type StrategyFunc func(key any, shards int) (index int, err error)
+
+func (fn StrategyFunc) Shard(key any, shards int) (index int, err error) {
+	return fn(key, shards)
+}
+
+type hashStrategy struct{}
+
+func (hashStrategy) Shard(key any, shards int) (index int, err error) {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(fmt.Sprint(indirect(key))))
+	return int(hash.Sum32() % uint32(shards)), nil
+}
+
+// HashStrategy distributes the keys by the fnv hash of their string form.
+func HashStrategy() Strategy {
+	return hashStrategy{}
+}
+
+type rangeStrategy struct {
+	bounds []int64
+}
+
+func (s rangeStrategy) Shard(key any, shards int) (index int, err error) {
+	if len(s.bounds) != shards-1 {
+		return 0, fmt.Errorf("%w: %d bounds for %d shards", ErrInvalidStrategy, len(s.bounds), shards)
+	}
+
+	value, convertErr := toInt64(key)
+	if convertErr != nil {
+		return 0, convertErr
+	}
+
+	return sort.Search(len(s.bounds), func(i int) bool { return value < s.bounds[i] }), nil
+}
+
+// RangeStrategy distributes the integer keys by the upper bounds, the shard i holds the keys in
+// [bounds[i-1], bounds[i]), and the last shard holds the rest, so n shards need n-1 ascending bounds.
+//
+// example:
+//
+//	// shard 0: id < 1000000, shard 1: 1000000 <= id < 2000000, shard 2: id >= 2000000
+//	strategy := sharding.RangeStrategy(1000000, 2000000)
+func RangeStrategy(bounds ...int64) Strategy {
+	sorted := append([]int64(nil), bounds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return rangeStrategy{bounds: sorted}
+}
+
+type lookupStrategy struct {
+	lookup   func(key any) (index int, exist bool)
+	fallback Strategy
+}
+
+func (s lookupStrategy) Shard(key any, shards int) (index int, err error) {
+	if index, exist := s.lookup(indirect(key)); exist {
+		if index < 0 || index >= shards {
+			return 0, fmt.Errorf("%w: lookup index %d out of %d shards", ErrInvalidStrategy, index, shards)
+		}
+		return index, nil
+	}
+
+	if s.fallback == nil {
+		return 0, fmt.Errorf("%w: %v is not in the lookup table", ErrShardNotFound, key)
+	}
+
+	return s.fallback.Shard(key, shards)
+}
+
+// LookupStrategy maps the keys by the lookup function, such as reading a directory table, the keys
+// not found are mapped by the fallback strategy, or fail with ErrShardNotFound if the fallback is nil.
+func LookupStrategy(lookup func(key any) (index int, exist bool), fallback Strategy) Strategy {
+	return lookupStrategy{lookup: lookup, fallback: fallback}
+}
+
+// LookupTableStrategy maps the keys by the table, the keys are compared by their string form.
+func LookupTableStrategy(table map[string]int, fallback Strategy) Strategy {
+	return LookupStrategy(func(key any) (index int, exist bool) {
+		index, exist = table[fmt.Sprint(key)]
+		return index, exist
+	}, fallback)
+}
+
+func indirect(value any) any {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		return nil
+	}
+
+	return rv.Interface()
+}
+
+func toInt64(value any) (int64, error) {
+	rv := reflect.ValueOf(indirect(value))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	case reflect.String:
+		parsed, err := strconv.ParseInt(rv.String(), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v is not an integer", ErrInvalidShardKey, value)
+		}
+		return parsed, nil
+	default:
+		return 0, fmt.Errorf("%w: %v is not an integer", ErrInvalidShardKey, value)
+	}
+}
@@ -0,0 +1,94 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alioth-center/infrastructure/database"
+	"github.com/alioth-center/infrastructure/database/sqlite"
+	"github.com/alioth-center/infrastructure/logger"
+	"github.com/alioth-center/infrastructure/trace"
+	"gorm.io/gorm"
+)
+
+type order struct {
+	ID     int    `gorm:"primaryKey;column:id"`
+	UserID int    `gorm:"column:user_id"`
+	Title  string `gorm:"column:title"`
+}
+
+func TestRouter(t *testing.T) {
+	shards := make([]database.DatabaseV2, 3)
+	for i := range shards {
+		db, err := sqlite.NewWithLogger(sqlite.Config{Database: fmt.Sprintf("file:sharding_test_%d?mode=memory&cache=shared", i)}, logger.Mute(), &order{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards[i] = db
+	}
+
+	router, err := NewRouter("user_id", RangeStrategy(100, 200), shards...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := trace.NewContext()
+	orders := []order{{ID: 1, UserID: 10, Title: "a"}, {ID: 2, UserID: 150, Title: "b"}, {ID: 3, UserID: 250, Title: "c"}, {ID: 4, UserID: 20, Title: "d"}, {ID: 5, UserID: 160, Title: "e"}}
+	if err = router.CreateDataOnDuplicateKeyUpdate(ctx, orders, []string{"id"}, []string{"title"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []order
+	if err = shards[0].ListDataWithPage(ctx, &stored, map[string]any{}, "id", false, 0, 10); err != nil || len(stored) != 2 {
+		t.Fatalf("expected 2 orders in shard 0, got %+v, error %v", stored, err)
+	}
+
+	var page []order
+	if err = router.ListDataWithPage(ctx, &page, map[string]any{}, "id", true, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].ID != 3 || page[1].ID != 2 {
+		t.Fatalf("unexpected scatter-gather page: %+v", page)
+	}
+
+	if count, countErr := router.CountData(ctx, &order{}, map[string]any{}); countErr != nil || count != 5 {
+		t.Fatalf("expected 5 orders in all shards, got %d, error %v", count, countErr)
+	}
+	if count, countErr := router.CountData(ctx, &order{}, map[string]any{"user_id": 150}); countErr != nil || count != 1 {
+		t.Fatalf("expected 1 order of the user, got %d, error %v", count, countErr)
+	}
+
+	var found order
+	if err = router.GetDataBySingleCondition(ctx, &found, "user_id", 250); err != nil || found.ID != 3 {
+		t.Fatalf("unexpected routed order: %+v, error %v", found, err)
+	}
+	if err = router.GetDataBySingleCondition(ctx, &found, "id", 3); !errors.Is(err, ErrShardKeyRequired) {
+		t.Fatalf("expected shard key required error, got %v", err)
+	}
+	if err = router.UpdateDataBySingleCondition(ctx, &order{UserID: 250, Title: "updated"}, "id", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	err = router.Transaction(ctx, []any{10, 150}, func(tx *gorm.DB) error { return nil })
+	if !errors.Is(err, ErrCrossShardTransaction) {
+		t.Fatalf("expected cross shard transaction error, got %v", err)
+	}
+	err = router.Transaction(ctx, []any{150, 160}, func(tx *gorm.DB) error {
+		return tx.Model(&order{}).Where("user_id = ?", 150).Update("title", "in transaction").Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index, _ := HashStrategy().Shard("user-1", 3); index < 0 || index > 2 {
+		t.Fatalf("unexpected hash shard: %d", index)
+	}
+	lookup := LookupTableStrategy(map[string]int{"vip": 2}, nil)
+	if index, _ := lookup.Shard("vip", 3); index != 2 {
+		t.Fatalf("unexpected lookup shard: %d", index)
+	}
+	if _, err = lookup.Shard("normal", 3); !errors.Is(err, ErrShardNotFound) {
+		t.Fatalf("expected shard not found error, got %v", err)
+	}
+}
@@ -7,21 +7,27 @@ import (
 )
 
 type Config struct {
-	Database      string `yaml:"database,omitempty" json:"database,omitempty" xml:"database,omitempty"`
-	Stdout        string `yaml:"stdout,omitempty" json:"stdout,omitempty" xml:"stdout,omitempty"`
-	Stderr        string `yaml:"stderr,omitempty" json:"stderr,omitempty" xml:"stderr,omitempty"`
-	MaxIdle       int    `yaml:"max_idle,omitempty" json:"max_idle,omitempty" xml:"max_idle,omitempty"`
-	MaxOpen       int    `yaml:"max_open,omitempty" json:"max_open,omitempty" xml:"max_open,omitempty"`
-	MaxLifeSecond int    `yaml:"max_life_second,omitempty" json:"max_life_second,omitempty" xml:"max_life_second,omitempty"`
-	TimeoutSecond int    `yaml:"timeout_second,omitempty" json:"timeout_second,omitempty" xml:"timeout_second,omitempty"`
+	Database                 string  `yaml:"database,omitempty" json:"database,omitempty" xml:"database,omitempty"`
+	Stdout                   string  `yaml:"stdout,omitempty" json:"stdout,omitempty" xml:"stdout,omitempty"`
+	Stderr                   string  `yaml:"stderr,omitempty" json:"stderr,omitempty" xml:"stderr,omitempty"`
+	MaxIdle                  int     `yaml:"max_idle,omitempty" json:"max_idle,omitempty" xml:"max_idle,omitempty"`
+	MaxOpen                  int     `yaml:"max_open,omitempty" json:"max_open,omitempty" xml:"max_open,omitempty"`
+	MaxLifeSecond            int     `yaml:"max_life_second,omitempty" json:"max_life_second,omitempty" xml:"max_life_second,omitempty"`
+	TimeoutSecond            int     `yaml:"timeout_second,omitempty" json:"timeout_second,omitempty" xml:"timeout_second,omitempty"`
+	SlowThresholdMillisecond int     `yaml:"slow_threshold_millisecond,omitempty" json:"slow_threshold_millisecond,omitempty" xml:"slow_threshold_millisecond,omitempty"`
+	SqlSampleRate            float64 `yaml:"sql_sample_rate,omitempty" json:"sql_sample_rate,omitempty" xml:"sql_sample_rate,omitempty"`
+	RedactSqlParams          bool    `yaml:"redact_sql_params,omitempty" json:"redact_sql_params,omitempty" xml:"redact_sql_params,omitempty"`
 }
 
 func convertConfigToOptions(cfg Config) (opt database.Options) {
 	return database.Options{
-		DataSource: cfg.Database,
-		MaxIdle:    cfg.MaxIdle,
-		MaxOpen:    cfg.MaxOpen,
-		MaxLife:    time.Duration(cfg.MaxLifeSecond) * time.Second,
-		Timeout:    time.Duration(cfg.TimeoutSecond) * time.Second,
+		DataSource:      cfg.Database,
+		MaxIdle:         cfg.MaxIdle,
+		MaxOpen:         cfg.MaxOpen,
+		MaxLife:         time.Duration(cfg.MaxLifeSecond) * time.Second,
+		Timeout:         time.Duration(cfg.TimeoutSecond) * time.Second,
+		SlowThreshold:   time.Duration(cfg.SlowThresholdMillisecond) * time.Millisecond,
+		SqlSampleRate:   cfg.SqlSampleRate,
+		RedactSqlParams: cfg.RedactSqlParams,
 	}
 }
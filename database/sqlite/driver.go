@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/alioth-center/infrastructure/database"
 	"github.com/alioth-center/infrastructure/exit"
@@ -14,6 +15,10 @@ import (
 
 const DriverName = "sqlite"
 
+func init() {
+	database.RegisterDriver(DriverName, open)
+}
+
 type sqliteDb struct {
 	database.BaseDatabaseImplement
 	database.BaseDatabaseImplementV2
@@ -49,7 +54,10 @@ func (s *sqliteDb) Init(options database.Options) error {
 			return err
 		}
 	}
-	db.Logger = database.NewDBLogger(options.Logger)
+	db.Logger = database.NewDBLoggerFromOptions(options)
+	if registerErr := database.RegisterChangeCallbacks(db, options.Logger); registerErr != nil {
+		return fmt.Errorf("register sqliteDb change callbacks error: %w", registerErr)
+	}
 
 	// 设置数据库连接池
 	sqlDb, dbe := db.DB()
@@ -62,6 +70,8 @@ func (s *sqliteDb) Init(options database.Options) error {
 
 	// 连接成功
 	s.BaseDatabaseImplement.Db, s.BaseDatabaseImplementV2.Db = db, db
+	s.BaseDatabaseImplementV2.Timeout = s.BaseDatabaseImplement.Timeout
+	s.BaseDatabaseImplementV2.MaxIdle = options.MaxIdle
 	s.Logger.Info(logger.NewFields().WithMessage("successfully open sqliteDb database").WithData(dataSource))
 
 	// 注册退出事件
@@ -114,3 +124,19 @@ func NewWithLogger(config Config, logger logger.Logger, models ...any) (db datab
 
 	return rdb, nil
 }
+
+// open opens the sqlite database for database.Open, the path of the url is the database, such as
+// sqlite://data/app.db, sqlite:///var/lib/app.db or sqlite://:memory:.
+func open(options database.Options, models ...any) (db database.DatabaseV2, err error) {
+	rdb := &sqliteDb{}
+	options.DataSource = strings.TrimPrefix(options.DataSource, DriverName+"://")
+	if initErr := rdb.Init(options); initErr != nil {
+		return nil, fmt.Errorf("init sqliteDb database error: %w", initErr)
+	}
+
+	if migrateErr := rdb.Migrate(models...); migrateErr != nil {
+		return nil, fmt.Errorf("migrate sqliteDb database error: %w", migrateErr)
+	}
+
+	return rdb, nil
+}
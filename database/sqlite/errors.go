@@ -0,0 +1,37 @@
+package sqlite
+
+import (
+	"errors"
+
+	"github.com/alioth-center/infrastructure/database"
+	driver "github.com/glebarez/go-sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func init() {
+	database.RegisterErrorClassifier(DriverName, classifyError)
+}
+
+func classifyError(err error) error {
+	var sqliteErr *driver.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return database.ErrDuplicateKey
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return database.ErrForeignKey
+	}
+
+	// sqlite reports the lock conflicts as busy or locked, they are the lock wait timeout of other databases
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return database.ErrLockTimeout
+	case sqlite3.SQLITE_INTERRUPT:
+		return database.ErrQueryCanceled
+	default:
+		return nil
+	}
+}
@@ -1,9 +1,12 @@
 package sqlite
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/alioth-center/infrastructure/database"
+	"github.com/alioth-center/infrastructure/logger"
 	"github.com/alioth-center/infrastructure/trace"
 )
 
@@ -39,3 +42,53 @@ func TestSqliteDb(t *testing.T) {
 	t.Log(sqlite.GetAll(&values, ""))
 	t.Log(values)
 }
+
+func TestClassifyError(t *testing.T) {
+	ctx := trace.NewContext()
+	db, err := NewWithLogger(Config{Database: "file:classify_error?mode=memory&cache=shared"}, logger.Mute(), &table{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.CreateDataOnDuplicateKeyUpdate(ctx, &table{ID: 1, Value: "first"}, []string{"id"}, []string{"value"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.ExecuteNamedSql(ctx, "INSERT INTO test_table (id, value) VALUES (:id, :value)", map[string]any{"id": 1, "value": "second"})
+	if !errors.Is(err, database.ErrDuplicateKey) || database.IsTransientError(err) {
+		t.Fatalf("expected duplicate key error, got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	ctx := trace.NewContext()
+	db, err := database.Open("sqlite://file:open_url?mode=memory&cache=shared&max_open=3&slow_threshold=100ms", &table{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := db.PoolStats(); stats.MaxOpen != 3 {
+		t.Fatalf("expected max open 3, got %d", stats.MaxOpen)
+	}
+	if _, err = db.CreateSingleDataIfNotExist(ctx, &table{ID: 1, Value: "open"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := database.Config{Driver: DriverName, DataSource: "file:open_url?mode=memory&cache=shared", MaxOpen: 2}
+	configured, err := database.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found table
+	if err = configured.GetDataBySingleCondition(ctx, &found, "id", 1); err != nil || found.Value != "open" {
+		t.Fatalf("expected shared row, got %v, %v", found, err)
+	}
+
+	if _, err = database.Open("oracle://localhost/db"); !errors.Is(err, database.ErrUnknownDriver) {
+		t.Fatalf("expected unknown driver, got %v", err)
+	}
+	if _, err = database.Open("sqlite://:memory:?max_idle=many"); !errors.Is(err, database.ErrInvalidDataSource) {
+		t.Fatalf("expected invalid data source, got %v", err)
+	}
+}
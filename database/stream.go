@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"iter"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidBatchSize = errors.New("invalid batch size, must be greater than zero")
+
+// StreamData iterates the rows of the model T matching the condition one by one, the rows are read from the
+// database cursor instead of being loaded into a slice, so it is suitable for exporting large tables. The
+// operation timeout of DatabaseV2 is not applied to the stream, which lasts as long as the caller iterates,
+// the stream stops with ErrQueryCanceled or ErrQueryTimeout when the context is done. Breaking the loop
+// closes the cursor.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for the database operation.
+//	db (DatabaseV2): The database to read.
+//	condition (any): The condition to filter the rows, see GetDataByCustomCondition.
+//	needFields (...string): The fields to select, all fields are selected if absent.
+//
+// Returns:
+//
+//	rows (iter.Seq2[T, error]): The iterator of the rows, the error is yielded once with the zero row and
+//	stops the iteration.
+//
+// example:
+//
+//	for user, err := range database.StreamData[User](ctx, db, map[string]any{"status": "active"}) {
+//		if err != nil {
+//			return err
+//		}
+//		// process the user
+//	}
+func StreamData[T any](ctx context.Context, db DatabaseV2, condition any, needFields ...string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		if EmptyCondition(condition) {
+			yield(zero, ErrInvalidCondition)
+			return
+		}
+
+		if len(needFields) == 0 {
+			needFields = append(needFields, "*")
+		}
+
+		core := db.GetGormCore(ctx)
+		rows, queryErr := core.Model(new(T)).Where(condition).Select(needFields).Rows()
+		if queryErr != nil {
+			yield(zero, classifyOperationError(ctx, queryErr))
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			// some drivers do not interrupt the cursor, the context is checked between the rows
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				yield(zero, classifyOperationError(ctx, ctxErr))
+				return
+			}
+
+			var row T
+			if scanErr := core.ScanRows(rows, &row); scanErr != nil {
+				yield(zero, ClassifyError(scanErr))
+				return
+			}
+
+			if !yield(row, nil) {
+				return
+			}
+		}
+
+		if rowsErr := rows.Err(); rowsErr != nil {
+			yield(zero, classifyOperationError(ctx, rowsErr))
+		}
+	}
+}
+
+// StreamDataInBatches reads the rows of the model T matching the condition in batches ordered by the primary
+// key, and calls the handler with every batch. The model T must have a primary key, and like StreamData the
+// operation timeout of DatabaseV2 is not applied. The batch is reused by the next batch, the handler should
+// copy the rows it retains.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for the database operation.
+//	db (DatabaseV2): The database to read.
+//	condition (any): The condition to filter the rows, see GetDataByCustomCondition.
+//	batchSize (int): The max count of the rows in a batch.
+//	handler (func(ctx context.Context, batch []T) error): The handler of the batches, returning an error stops
+//	the reading and returns the error.
+//
+// Returns:
+//
+//	processed (int): The count of the rows passed to the handler.
+//	err (error): The error of the reading or the handler.
+//
+// example:
+//
+//	condition := map[string]any{"status": "finished"}
+//	processed, err := database.StreamDataInBatches(ctx, db, condition, 500, func(ctx context.Context, batch []Order) error {
+//		return archive.Upload(ctx, batch)
+//	})
+func StreamDataInBatches[T any](ctx context.Context, db DatabaseV2, condition any, batchSize int, handler func(ctx context.Context, batch []T) error, needFields ...string) (processed int, err error) {
+	if EmptyCondition(condition) {
+		return 0, ErrInvalidCondition
+	}
+	if batchSize <= 0 {
+		return 0, ErrInvalidBatchSize
+	}
+
+	if len(needFields) == 0 {
+		needFields = append(needFields, "*")
+	}
+
+	var batch []T
+	var handlerErr error
+	result := db.GetGormCore(ctx).Model(new(T)).Where(condition).Select(needFields).FindInBatches(&batch, batchSize, func(_ *gorm.DB, _ int) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if handlerErr = handler(ctx, batch); handlerErr != nil {
+			return handlerErr
+		}
+
+		processed += len(batch)
+		return nil
+	})
+
+	if handlerErr != nil {
+		return processed, handlerErr
+	}
+
+	return processed, classifyOperationError(ctx, result.Error)
+}
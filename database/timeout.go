@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type timeoutContextKey struct{}
+
+// WithTimeout overrides the operation timeout of the DatabaseV2 methods called with the context, the
+// timeout not greater than zero disables the timeout. The deadline of the context itself still applies,
+// so the earlier one of them cancels the operation.
+//
+// example:
+//
+//	// the report query may take longer than the default timeout
+//	err := db.ExecuteRawSqlQuery(database.WithTimeout(ctx, time.Minute), &report, reportSql)
+func WithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutContextKey{}, timeout)
+}
+
+// TimeoutFromContext returns the operation timeout set by WithTimeout.
+func TimeoutFromContext(ctx context.Context) (timeout time.Duration, exist bool) {
+	timeout, exist = ctx.Value(timeoutContextKey{}).(time.Duration)
+	return timeout, exist
+}
+
+// session returns the session bounded by the operation timeout, the drivers stop the running statement
+// when the context is done: pgx sends a cancel request to the server, sqlite interrupts the statement,
+// and mysql closes the connection of the statement.
+func (v2 *BaseDatabaseImplementV2) session(ctx context.Context) (db *gorm.DB, operation context.Context, cancel context.CancelFunc) {
+	timeout := v2.Timeout
+	if override, exist := TimeoutFromContext(ctx); exist {
+		timeout = override
+	}
+
+	if timeout > 0 {
+		operation, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		operation, cancel = context.WithCancel(ctx)
+	}
+
+	return v2.Db.WithContext(operation), operation, cancel
+}
+
+// classifyOperationError classifies the error of the operation, the errors caused by the timeout or
+// the cancellation of the operation context are ErrQueryTimeout or ErrQueryCanceled, no matter how the
+// driver reports them.
+func classifyOperationError(operation context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, ErrQueryTimeout) || errors.Is(err, ErrQueryCanceled):
+		return err
+	case errors.Is(operation.Err(), context.DeadlineExceeded):
+		return &ClassifiedError{Kind: ErrQueryTimeout, Err: err}
+	case errors.Is(operation.Err(), context.Canceled):
+		return &ClassifiedError{Kind: ErrQueryCanceled, Err: err}
+	default:
+		return ClassifyError(err)
+	}
+}
@@ -2,9 +2,19 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alioth-center/infrastructure/logger"
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
-	"testing"
+	"gorm.io/gorm/clause"
 )
 
 type User struct {
@@ -13,6 +23,27 @@ type User struct {
 	Age  int
 }
 
+// newTestDatabase opens the in-memory sqlite database of the name with the models migrated, the database is
+// closed when the test finishes.
+func newTestDatabase(t *testing.T, name string, models ...any) *BaseDatabaseImplementV2 {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{Logger: NewDBLogger(logger.Mute())})
+	if err != nil {
+		t.Fatalf("failed to connect database: %v", err)
+	}
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDb, dbErr := db.DB(); dbErr == nil {
+			_ = sqlDb.Close()
+		}
+	})
+
+	return &BaseDatabaseImplementV2{Db: db}
+}
+
 func TestBaseDatabaseImplementV2(t *testing.T) {
 	// 创建内存中的 SQLite 数据库
 	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
@@ -72,3 +103,652 @@ func TestBaseDatabaseImplementV2(t *testing.T) {
 		t.Fatalf("expected user age to be 26, got %d", retrievedUser.Age)
 	}
 }
+
+func TestDBLogger(t *testing.T) {
+	dl := NewDBLogger(logger.Mute(), WithSlowThresholdOpts(time.Nanosecond), WithSampleRateOpts(0.5), WithParamRedactionOpts(true))
+	db := newTestDatabase(t, "db_logger", &User{}).Db.Session(&gorm.Session{Logger: dl})
+
+	dl.ResetMetrics()
+	ctx := context.Background()
+	if err := db.WithContext(ctx).Create(&User{Name: "Bob", Age: 30}).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	var users []User
+	if err := db.WithContext(ctx).Where("name = ?", "Bob").Find(&users).Error; err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+	_ = db.WithContext(ctx).Exec("select * from not_exist_table").Error
+
+	metrics := dl.Metrics()
+	if metrics[StatementKindInsert].Count != 1 || metrics[StatementKindInsert].Slow != 1 {
+		t.Fatalf("unexpected insert metrics: %+v", metrics[StatementKindInsert])
+	}
+	if metrics[StatementKindSelect].Count != 2 || metrics[StatementKindSelect].Errors != 1 {
+		t.Fatalf("unexpected select metrics: %+v", metrics[StatementKindSelect])
+	}
+
+	var bucketTotal int64
+	for _, bucket := range metrics[StatementKindSelect].Buckets {
+		bucketTotal += bucket.Count
+	}
+	if bucketTotal != 2 {
+		t.Fatalf("expected 2 statements in histogram, got %d", bucketTotal)
+	}
+
+	if sql, params := dl.ParamsFilter(ctx, "select * from users where name = ?", "Bob"); sql != "select * from users where name = ?" || params != nil {
+		t.Fatalf("expected params to be redacted, got %v", params)
+	}
+	if found, ok := DBLoggerOf(db); !ok || found != dl {
+		t.Fatalf("expected to find db logger")
+	}
+
+	kinds := map[string]StatementKind{
+		"SELECT 1":                      StatementKindSelect,
+		"  (select 1) union (select 2)": StatementKindSelect,
+		"INSERT INTO users VALUES (1)":  StatementKindInsert,
+		"update users set age = 1":      StatementKindUpdate,
+		"DELETE FROM users":             StatementKindDelete,
+		"CREATE TABLE users (id int)":   StatementKindOther,
+	}
+	for sql, expected := range kinds {
+		if kind := DetectStatementKind(sql); kind != expected {
+			t.Fatalf("expected %s for %q, got %s", expected, sql, kind)
+		}
+	}
+}
+
+type versionedUser struct {
+	ID      int    `gorm:"primaryKey;column:id"`
+	Name    string `gorm:"column:name"`
+	Balance int    `gorm:"column:balance"`
+	Version int64  `gorm:"column:version" lock:"version"`
+}
+
+func TestOptimisticLock(t *testing.T) {
+	baseDB := newTestDatabase(t, "optimistic_lock", &versionedUser{})
+	ctx := context.Background()
+	if err := baseDB.Db.Create(&versionedUser{ID: 1, Name: "Carol", Balance: 10}).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	var first, second versionedUser
+	_ = baseDB.GetDataBySingleCondition(ctx, &first, "id", 1)
+	_ = baseDB.GetDataBySingleCondition(ctx, &second, "id", 1)
+
+	first.Balance = 20
+	if err := baseDB.UpdateDataBySingleCondition(ctx, &first, "id", 1); err != nil {
+		t.Fatalf("failed to update with version: %v", err)
+	}
+	if first.Version != 1 {
+		t.Fatalf("expected version to be increased to 1, got %d", first.Version)
+	}
+
+	second.Balance = 30
+	if err := baseDB.UpdateDataByCustomCondition(ctx, &second, map[string]any{"id": 1}); !errors.Is(err, ErrStaleData) {
+		t.Fatalf("expected stale data error, got %v", err)
+	}
+	if second.Version != 0 {
+		t.Fatalf("expected version to be restored after stale update, got %d", second.Version)
+	}
+
+	calls := 0
+	updated, err := UpdateWithOptimisticLock(ctx, baseDB, "id", 1, 3, func(user *versionedUser) error {
+		calls++
+		if calls == 1 {
+			// simulate a concurrent update between loading and updating
+			baseDB.Db.Model(&versionedUser{}).Where("id = ?", 1).Updates(map[string]any{"balance": 40, "version": gorm.Expr("version + 1")})
+		}
+
+		user.Balance += 5
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to update with retry: %v", err)
+	}
+	if calls != 2 || updated.Balance != 45 || updated.Version != 3 {
+		t.Fatalf("unexpected retry result, calls %d, user %+v", calls, updated)
+	}
+}
+
+type upsertUser struct {
+	ID   int    `gorm:"primaryKey;column:id"`
+	Name string `gorm:"column:name;uniqueIndex"`
+	Age  int    `gorm:"column:age"`
+}
+
+func TestBatchUpsert(t *testing.T) {
+	baseDB := newTestDatabase(t, "batch_upsert", &upsertUser{})
+	ctx := context.Background()
+
+	rows := make([]upsertUser, 12000)
+	for i := range rows {
+		rows[i] = upsertUser{ID: i + 1, Name: "user-" + strconv.Itoa(i), Age: 1}
+	}
+	result, err := baseDB.BatchUpsert(ctx, rows, 0, []string{"name"}, []string{"age"}, true)
+	if err != nil {
+		t.Fatalf("failed to batch upsert beyond placeholder limit: %v", err)
+	}
+	if result.Affected != int64(len(rows)) || result.CountsReported {
+		t.Fatalf("unexpected upsert result: %+v", result)
+	}
+
+	updates := []*upsertUser{{ID: 1, Name: "user-0", Age: 2}, {ID: 12001, Name: "user-new", Age: 3}}
+	if _, err := baseDB.BatchUpsert(ctx, &updates, 1, []string{"name"}, []string{"age"}, false); err != nil {
+		t.Fatalf("failed to batch upsert: %v", err)
+	}
+
+	var count int64
+	baseDB.Db.Model(&upsertUser{}).Count(&count)
+	var updated upsertUser
+	baseDB.Db.Where("name = ?", "user-0").Take(&updated)
+	if count != 12001 || updated.Age != 2 {
+		t.Fatalf("unexpected rows after upsert, count %d, user %+v", count, updated)
+	}
+
+	array := [2]upsertUser{{ID: 12002, Name: "user-array-0", Age: 4}, {ID: 12003, Name: "user-array-1", Age: 4}}
+	if result, err := baseDB.BatchUpsert(ctx, array, 1, []string{"name"}, []string{"age"}, false); err != nil || result.Affected != 2 {
+		t.Fatalf("failed to batch upsert array: %v, result %+v", err, result)
+	}
+
+	if _, err := baseDB.BatchUpsert(ctx, updates[0], 0, []string{"name"}, []string{"age"}, false); !errors.Is(err, ErrInvalidBatchData) {
+		t.Fatalf("expected invalid batch data error, got %v", err)
+	}
+	if size, _ := upsertBatchSize(baseDB.Db, rows, 0); size != 32766/3 {
+		t.Fatalf("unexpected batch size: %d", size)
+	}
+}
+
+func TestNamedSql(t *testing.T) {
+	named, err := ParseNamedSql("SELECT ':skip', id::text FROM users -- :comment\nWHERE age > :age [[AND id IN (:ids)]] [[AND name = @name]] AND mark = '?'")
+	if err != nil {
+		t.Fatalf("failed to parse named sql: %v", err)
+	}
+
+	sql, args, err := named.Bind(map[string]any{"age": 18, "ids": []int{1, 2}}, PlaceholderDollar)
+	if err != nil {
+		t.Fatalf("failed to bind named sql: %v", err)
+	}
+	expected := "SELECT ':skip', id::text FROM users -- :comment\nWHERE age > $1 AND id IN ($2, $3)  AND mark = '?'"
+	if sql != expected || len(args) != 3 || args[2] != 2 {
+		t.Fatalf("unexpected bind result: %q %v", sql, args)
+	}
+
+	if cached, _ := ParseNamedSql("SELECT ':skip', id::text FROM users -- :comment\nWHERE age > :age [[AND id IN (:ids)]] [[AND name = @name]] AND mark = '?'"); cached != named {
+		t.Fatal("expected parsed template to be cached")
+	}
+	if _, _, err = named.Bind(map[string]any{}, PlaceholderQuestion); !errors.Is(err, ErrMissingNamedParameter) {
+		t.Fatalf("expected missing parameter error, got %v", err)
+	}
+	if _, err = ParseNamedSql("SELECT 1 [[AND [[nested]]]]"); !errors.Is(err, ErrInvalidNamedSql) {
+		t.Fatalf("expected invalid named sql error, got %v", err)
+	}
+
+	// the backslashes are not escapes, the quote after it closes the string like postgres
+	backslash, _ := ParseNamedSql(`SELECT 'C:\' || :dir, 'it''s :kept'`)
+	if sql, args, err = backslash.Bind(map[string]any{"dir": "tmp"}, PlaceholderQuestion); err != nil || sql != `SELECT 'C:\' || ?, 'it''s :kept'` || len(args) != 1 {
+		t.Fatalf("unexpected bind result with backslash: %q %v %v", sql, args, err)
+	}
+
+	for i := 0; namedSqlCache.Length() < namedSqlCacheSize; i++ {
+		_, _ = ParseNamedSql("SELECT " + strconv.Itoa(i))
+	}
+	if first, _ := ParseNamedSql("SELECT :uncached"); first == nil || namedSqlCache.Length() != namedSqlCacheSize {
+		t.Fatalf("expected the cache to be capped at %d, got %d", namedSqlCacheSize, namedSqlCache.Length())
+	}
+
+	baseDB := newTestDatabase(t, "named_sql", &upsertUser{})
+	ctx := context.Background()
+	injection := "x'); DROP TABLE upsert_users; --"
+	if err = baseDB.ExecuteNamedSql(ctx, "INSERT INTO upsert_users (id, name, age) VALUES (:id, :name, :age)", map[string]any{"id": 1, "name": injection, "age": 20}); err != nil {
+		t.Fatalf("failed to execute named sql: %v", err)
+	}
+	_ = baseDB.ExecuteNamedSql(ctx, "INSERT INTO upsert_users (id, name, age) VALUES (:id, :name, :age)", map[string]any{"id": 2, "name": "what?", "age": 30})
+
+	var users []upsertUser
+	query := "SELECT * FROM upsert_users WHERE name <> '?' [[AND id IN (:ids)]] [[AND age >= :age]] ORDER BY id"
+	if err = baseDB.ExecuteNamedSqlQuery(ctx, &users, query, map[string]any{"ids": []int{1, 2}, "age": nil}); err != nil {
+		t.Fatalf("failed to execute named sql query: %v", err)
+	}
+	if len(users) != 2 || users[0].Name != injection {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+
+	users = nil
+	_ = baseDB.ExecuteNamedSqlQuery(ctx, &users, query, map[string]any{"age": 25})
+	if len(users) != 1 || users[0].Name != "what?" {
+		t.Fatalf("unexpected users with optional clause: %+v", users)
+	}
+}
+
+func TestPoolMonitor(t *testing.T) {
+	baseDB := newTestDatabase(t, "pool_monitor")
+	ctx := context.Background()
+	if err := baseDB.HealthCheck(ctx); err != nil {
+		t.Fatalf("expected database to be healthy, got %v", err)
+	}
+
+	sqlDb, _ := baseDB.Db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	conn, _ := sqlDb.Conn(ctx)
+	stats := baseDB.PoolStats()
+	if stats.MaxOpen != 1 || stats.InUse != 1 || stats.Saturation() != 1 {
+		t.Fatalf("unexpected pool stats: %+v", stats)
+	}
+	_ = conn.Close()
+
+	monitor := NewPoolMonitor(baseDB, WithMonitorLoggerOpts(logger.Mute()), WithMonitorTimeoutOpts(50*time.Millisecond))
+	if _, err := monitor.Check(ctx); err != nil || !monitor.Healthy() {
+		t.Fatalf("expected monitor check to pass, got %v", err)
+	}
+
+	// flushing the idle connections restores the configured max idle connections
+	baseDB.MaxIdle = 5
+	sqlDb.SetMaxOpenConns(0)
+	sqlDb.SetMaxIdleConns(5)
+	idle := func() int {
+		conns := make([]*sql.Conn, 3)
+		for i := range conns {
+			conns[i], _ = sqlDb.Conn(ctx)
+		}
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		return sqlDb.Stats().Idle
+	}
+	if count := idle(); count != 3 {
+		t.Fatalf("expected 3 idle connections, got %d", count)
+	}
+	monitor.flushIdle(ctx, baseDB.PoolStats())
+	if count := sqlDb.Stats().Idle; count != 0 {
+		t.Fatalf("expected the idle connections to be flushed, got %d", count)
+	}
+	if count := idle(); count != 3 {
+		t.Fatalf("expected the max idle connections to be kept, got %d idle connections", count)
+	}
+
+	_ = sqlDb.Close()
+	if _, err := monitor.Check(ctx); err == nil || monitor.Healthy() {
+		t.Fatal("expected monitor check to fail after the database is closed")
+	}
+
+	monitor.Start()
+	monitor.Stop()
+}
+
+func TestRetry(t *testing.T) {
+	transient := &ClassifiedError{Kind: ErrDeadlock, Err: errors.New("deadlock found when trying to get lock")}
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	attempts := 0
+	err := Retry(context.Background(), policy, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("expected retry to succeed at the third attempt, got %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	err = Retry(context.Background(), policy, func(ctx context.Context) error {
+		attempts++
+		return gorm.ErrRecordNotFound
+	})
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, gorm.ErrRecordNotFound) || attempts != 1 {
+		t.Fatalf("expected not found error without retry, got %v after %d attempts", err, attempts)
+	}
+
+	if delay := policy.Delay(10); delay != 2*time.Millisecond {
+		t.Fatalf("expected delay to be capped, got %s", delay)
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		if delay := policy.Delay(1); delay < 500*time.Microsecond || delay > 1500*time.Microsecond {
+			t.Fatalf("unexpected jittered delay: %s", delay)
+		}
+	}
+
+	baseDB := newTestDatabase(t, "transaction_retry", &upsertUser{})
+
+	attempts = 0
+	err = TransactionWithRetry(context.Background(), baseDB, policy, func(tx *gorm.DB) error {
+		attempts++
+		if createErr := tx.Create(&upsertUser{ID: 1, Name: "retry"}).Error; createErr != nil {
+			return createErr
+		}
+		if attempts == 1 {
+			return transient
+		}
+		return nil
+	})
+	var count int64
+	baseDB.Db.Model(&upsertUser{}).Count(&count)
+	if err != nil || attempts != 2 || count != 1 {
+		t.Fatalf("unexpected transaction retry result: %v, attempts %d, count %d", err, attempts, count)
+	}
+}
+
+type encryptedUser struct {
+	ID         int             `gorm:"primaryKey;column:id"`
+	Phone      EncryptedString `gorm:"column:phone"`
+	PhoneIndex BlindIndex      `gorm:"column:phone_index;index"`
+}
+
+func TestEncryptedString(t *testing.T) {
+	if err := RegisterEncryptionKey("k1", "0123456789abcdef"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterEncryptionKey("bad:id", "0123456789abcdef"); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Fatalf("expected invalid key error, got %v", err)
+	}
+	_ = SetPrimaryEncryptionKey("k1")
+	_ = SetBlindIndexKey("blind-index-secret")
+
+	baseDB := newTestDatabase(t, "encrypted_string", &encryptedUser{})
+	ctx := context.Background()
+	for i, phone := range []string{"13800000000", "13900000000"} {
+		if _, err := baseDB.CreateSingleDataIfNotExist(ctx, &encryptedUser{ID: i + 1, Phone: EncryptedString(phone), PhoneIndex: BlindIndex(phone)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var raw map[string]any
+	baseDB.Db.Table("encrypted_users").Where("id = ?", 1).Take(&raw)
+	if stored := fmt.Sprint(raw["phone"]); !strings.HasPrefix(stored, "k1:") || strings.Contains(stored, "13800000000") {
+		t.Fatalf("expected phone to be encrypted, got %s", stored)
+	}
+
+	var found encryptedUser
+	if err := baseDB.GetDataBySingleCondition(ctx, &found, "phone_index", BlindIndex("13900000000")); err != nil || found.ID != 2 || found.Phone != "13900000000" {
+		t.Fatalf("unexpected user found by blind index: %+v, error %v", found, err)
+	}
+	if err := baseDB.UpdateDataBySingleCondition(ctx, &found, "id", 2); err != nil {
+		t.Fatal(err)
+	}
+	found = encryptedUser{}
+	if _ = baseDB.GetDataBySingleCondition(ctx, &found, "phone_index", BlindIndex("13900000000")); found.ID != 2 {
+		t.Fatalf("expected blind index to be stable after saving, got %+v", found)
+	}
+
+	_ = RegisterEncryptionKey("k2", "fedcba9876543210fedcba9876543210")
+	_ = SetPrimaryEncryptionKey("k2")
+	updated, err := ReEncryptColumns(ctx, baseDB, &encryptedUser{}, 1, "phone")
+	if err != nil || updated != 2 {
+		t.Fatalf("expected 2 values re-encrypted, got %d, error %v", updated, err)
+	}
+	if updated, _ = ReEncryptColumns(ctx, baseDB, &encryptedUser{}, 1, "phone"); updated != 0 {
+		t.Fatalf("expected re-encryption to be idempotent, got %d", updated)
+	}
+
+	baseDB.Db.Table("encrypted_users").Where("id = ?", 1).Take(&raw)
+	found = encryptedUser{}
+	_ = baseDB.GetDataBySingleCondition(ctx, &found, "id", 1)
+	if !strings.HasPrefix(fmt.Sprint(raw["phone"]), "k2:") || found.Phone != "13800000000" {
+		t.Fatalf("unexpected re-encrypted user: %v, %+v", raw, found)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	baseDB := newTestDatabase(t, "query_timeout")
+
+	// counting to a billion takes seconds in sqlite, it is interrupted long before that, the sqlite driver
+	// only interrupts the statements stepped inside the call, so the slow statement is executed
+	slowSql := "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT count(*) FROM c"
+	baseDB.Timeout = 50 * time.Millisecond
+	ctx := context.Background()
+
+	start := time.Now()
+	err := baseDB.ExecuteRawSql(ctx, slowSql)
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("expected query timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the query to be interrupted, took %v", elapsed)
+	}
+
+	baseDB.Timeout = 0
+	if err := baseDB.ExecuteRawSql(WithTimeout(ctx, 50*time.Millisecond), slowSql); !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("expected query timeout by the context override, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := baseDB.ExecuteRawSql(canceled, slowSql); !errors.Is(err, ErrQueryCanceled) {
+		t.Fatalf("expected query canceled, got %v", err)
+	}
+
+	var count int64
+	if err := baseDB.ExecuteRawSqlQuery(WithTimeout(ctx, time.Second), &count, "SELECT 1"); err != nil || count != 1 {
+		t.Fatalf("expected the query to finish, got %d, %v", count, err)
+	}
+}
+
+type changedItem struct {
+	ID    int    `gorm:"primaryKey;column:id;autoIncrement"`
+	Name  string `gorm:"column:name"`
+	Price int    `gorm:"column:price"`
+}
+
+func (changedItem) TableName() string {
+	return "changed_items"
+}
+
+func TestChangeHooks(t *testing.T) {
+	baseDB := newTestDatabase(t, "change_hooks", &changedItem{})
+	if err := RegisterChangeCallbacks(baseDB.Db, logger.Mute()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	created := make(chan changedItem, 1)
+	defer AfterCreate(func(_ context.Context, item *changedItem) error {
+		created <- *item
+		return nil
+	}, DeliverAsync)()
+	if _, err := baseDB.CreateSingleDataIfNotExist(ctx, &changedItem{Name: "pen", Price: 10}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case item := <-created:
+		if item.ID == 0 || item.Name != "pen" {
+			t.Fatalf("unexpected created item: %+v", item)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the created item to be delivered")
+	}
+
+	// the async deliveries in a transaction wait for the commit, and are discarded by the rollback
+	rollback := errors.New("rollback")
+	if err := baseDB.Transaction(ctx, func(tx *gorm.DB) error {
+		if createErr := tx.Create(&changedItem{Name: "book", Price: 30}).Error; createErr != nil {
+			return createErr
+		}
+		return rollback
+	}); !errors.Is(err, rollback) {
+		t.Fatalf("expected the transaction to be rolled back, got %v", err)
+	}
+	if err := baseDB.Transaction(ctx, func(tx *gorm.DB) error {
+		if createErr := tx.Create(&changedItem{Name: "cup", Price: 5}).Error; createErr != nil {
+			return createErr
+		}
+		return tx.Transaction(func(nested *gorm.DB) error {
+			return nested.Create(&changedItem{Name: "box", Price: 8}).Error
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for len(names) < 2 {
+		select {
+		case item := <-created:
+			names = append(names, item.Name)
+		case <-time.After(time.Second):
+			t.Fatalf("expected the committed items to be delivered, got %v", names)
+		}
+	}
+	slices.Sort(names)
+	if names[0] != "box" || names[1] != "cup" {
+		t.Fatalf("unexpected delivered items: %v", names)
+	}
+	select {
+	case item := <-created:
+		t.Fatalf("unexpected delivered item: %+v", item)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var updates []string
+	unsubscribe := AfterUpdate(func(_ context.Context, old, new *changedItem) error {
+		if new.Price > 100 {
+			return errors.New("price too high")
+		}
+		updates = append(updates, fmt.Sprintf("%d->%d", old.Price, new.Price))
+		return nil
+	}, DeliverInTransaction)
+	if err := baseDB.UpdateDataBySingleCondition(ctx, &changedItem{Price: 20}, "name", "pen"); err != nil {
+		t.Fatal(err)
+	}
+	if err := baseDB.UpdateDataBySingleCondition(ctx, &changedItem{Price: 200}, "name", "pen"); err == nil {
+		t.Fatal("expected the handler error to fail the update")
+	}
+	var item changedItem
+	if err := baseDB.GetDataBySingleCondition(ctx, &item, "name", "pen"); err != nil || item.Price != 20 {
+		t.Fatalf("expected the failed update to be rolled back, got %+v, %v", item, err)
+	}
+	if len(updates) != 1 || updates[0] != "10->20" {
+		t.Fatalf("unexpected updates: %v", updates)
+	}
+	unsubscribe()
+
+	var deleted []string
+	defer AfterDelete(func(_ context.Context, item *changedItem) error {
+		deleted = append(deleted, item.Name)
+		return nil
+	}, DeliverInTransaction)()
+	if err := baseDB.GetGormCore(ctx).Where("name = ?", "pen").Delete(&changedItem{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0] != "pen" {
+		t.Fatalf("unexpected deleted items: %v", deleted)
+	}
+}
+
+type builderUpdates struct {
+	Updates
+}
+
+func (*builderUpdates) Model() any {
+	return &changedItem{}
+}
+
+func TestBuilders(t *testing.T) {
+	baseDB := newTestDatabase(t, "builders", &changedItem{})
+	ctx := context.Background()
+	if _, err := baseDB.CreateSingleDataIfNotExist(ctx, &changedItem{Name: "pen", Price: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	conditions := &Conditions{}
+	if err := baseDB.GetDataByCustomCondition(ctx, &[]changedItem{}, conditions); !errors.Is(err, ErrInvalidCondition) {
+		t.Fatalf("expected empty conditions to be rejected, got %v", err)
+	}
+
+	conditions.Add(clause.Eq{Column: clause.Column{Name: "name"}, Value: "pen"}, clause.Gt{Column: clause.Column{Name: "price"}, Value: 5})
+	updates := &builderUpdates{}
+	updates.Set("price", 0)
+	if err := baseDB.UpdateDataByCustomCondition(ctx, updates, conditions); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []changedItem
+	if err := baseDB.GetDataByCustomCondition(ctx, &items, map[string]any{"name": "pen"}); err != nil || len(items) != 1 || items[0].Price != 0 {
+		t.Fatalf("expected the zero price to be updated, got %+v, %v", items, err)
+	}
+}
+
+type streamedUser struct {
+	ID   int    `gorm:"primaryKey" json:"id"`
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestStreamData(t *testing.T) {
+	baseDB := newTestDatabase(t, "stream_data", &streamedUser{})
+	ctx := context.Background()
+	users := make([]streamedUser, 25)
+	for i := range users {
+		users[i] = streamedUser{ID: i + 1, Name: "user" + strconv.Itoa(i+1), Age: i}
+	}
+	if err := baseDB.Db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	adults := clause.Gte{Column: clause.Column{Name: "age"}, Value: 18}
+	streamed := 0
+	for user, streamErr := range StreamData[streamedUser](ctx, baseDB, adults) {
+		if streamErr != nil || user.Age < 18 {
+			t.Fatalf("unexpected streamed user %+v, %v", user, streamErr)
+		}
+		if streamed++; streamed == 3 {
+			break
+		}
+	}
+	if streamed != 3 {
+		t.Fatalf("expected to stop after 3 users, got %d", streamed)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	for _, streamErr := range StreamData[streamedUser](canceled, baseDB, adults) {
+		if !errors.Is(streamErr, ErrQueryCanceled) {
+			t.Fatalf("expected the stream to be canceled, got %v", streamErr)
+		}
+	}
+
+	var sizes []int
+	processed, err := StreamDataInBatches(ctx, baseDB, &Conditions{}, 10, func(_ context.Context, batch []streamedUser) error {
+		sizes = append(sizes, len(batch))
+		return nil
+	})
+	if !errors.Is(err, ErrInvalidCondition) {
+		t.Fatalf("expected empty condition to be rejected, got %v", err)
+	}
+	processed, err = StreamDataInBatches(ctx, baseDB, clause.Gte{Column: clause.Column{Name: "age"}, Value: 0}, 10, func(_ context.Context, batch []streamedUser) error {
+		sizes = append(sizes, len(batch))
+		return nil
+	})
+	if err != nil || processed != 25 || fmt.Sprint(sizes) != "[10 10 5]" {
+		t.Fatalf("unexpected batches %v, %d, %v", sizes, processed, err)
+	}
+
+	stopped := errors.New("stopped")
+	processed, err = StreamDataInBatches(ctx, baseDB, adults, 5, func(_ context.Context, _ []streamedUser) error {
+		return stopped
+	})
+	if !errors.Is(err, stopped) || processed != 0 {
+		t.Fatalf("expected the handler error, got %d, %v", processed, err)
+	}
+
+	csvOutput := &strings.Builder{}
+	exported, err := ExportCSV(csvOutput, StreamData[streamedUser](ctx, baseDB, clause.Gte{Column: clause.Column{Name: "age"}, Value: 23}), "id", "name")
+	if err != nil || exported != 2 || csvOutput.String() != "id,name\n24,user24\n25,user25\n" {
+		t.Fatalf("unexpected csv export %q, %d, %v", csvOutput.String(), exported, err)
+	}
+
+	jsonOutput := &strings.Builder{}
+	exported, err = ExportJSONLines(jsonOutput, StreamData[streamedUser](ctx, baseDB, clause.Gte{Column: clause.Column{Name: "age"}, Value: 24}))
+	if err != nil || exported != 1 || jsonOutput.String() != "{\"id\":25,\"name\":\"user25\",\"age\":24}\n" {
+		t.Fatalf("unexpected json lines export %q, %d, %v", jsonOutput.String(), exported, err)
+	}
+
+	encryptedOutput := &strings.Builder{}
+	encryptedRows := func(yield func(encryptedUser, error) bool) {
+		yield(encryptedUser{ID: 1, Phone: "13800000000", PhoneIndex: "13800000000"}, nil)
+	}
+	exported, err = ExportCSV(encryptedOutput, encryptedRows, "id", "phone", "phone_index")
+	if err != nil || exported != 1 || encryptedOutput.String() != "id,phone,phone_index\n1,13800000000,13800000000\n" {
+		t.Fatalf("expected the plain text in csv, got %q, %d, %v", encryptedOutput.String(), exported, err)
+	}
+}
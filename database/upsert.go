@@ -0,0 +1,82 @@
+package database
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpsertResult is the result of BatchUpsert. Inserted and Updated are only filled when the driver
+// reports them, which is indicated by CountsReported, otherwise only Affected is meaningful.
+type UpsertResult struct {
+	Affected       int64
+	Inserted       int64
+	Updated        int64
+	CountsReported bool
+}
+
+// placeholderLimits is the max number of bind parameters in a statement of each driver.
+var placeholderLimits = map[string]int{
+	"mysql":    65535,
+	"postgres": 65535,
+	"sqlite":   32766,
+}
+
+// defaultPlaceholderLimit is used for the unknown drivers, it is the limit of sqlite before 3.32.
+const defaultPlaceholderLimit = 999
+
+// upsertBatchSize calculates the max rows in a statement which does not exceed the placeholder
+// limit of the driver, the requested batch size is used if it is smaller.
+func upsertBatchSize(db *gorm.DB, rows any, batchSize int) (int, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(rows); err != nil {
+		return 0, err
+	}
+
+	limit, exist := placeholderLimits[db.Dialector.Name()]
+	if !exist {
+		limit = defaultPlaceholderLimit
+	}
+
+	fields := len(stmt.Schema.DBNames)
+	if fields == 0 {
+		fields = 1
+	}
+
+	maxRows := limit / fields
+	if maxRows == 0 {
+		maxRows = 1
+	}
+	if batchSize <= 0 || batchSize > maxRows {
+		return maxRows, nil
+	}
+
+	return batchSize, nil
+}
+
+// upsertChunks executes the upsert chunk by chunk, mysql counts an inserted row as 1 affected row and an
+// updated row as 2, so the inserted and updated counts are derived from it, rows updated with the same
+// values are counted as 0 and make the counts approximate.
+func upsertChunks(tx *gorm.DB, rows reflect.Value, batchSize int, onConflict clause.OnConflict) (result UpsertResult, err error) {
+	countsReported := tx.Dialector.Name() == "mysql"
+	for start := 0; start < rows.Len(); start += batchSize {
+		end := min(start+batchSize, rows.Len())
+		chunk := rows.Slice(start, end).Interface()
+		session := tx.Session(&gorm.Session{}).Clauses(onConflict).Create(chunk)
+		if session.Error != nil {
+			return result, session.Error
+		}
+
+		result.Affected += session.RowsAffected
+		if countsReported {
+			size := int64(end - start)
+			updated := min(max(session.RowsAffected-size, 0), size)
+			result.Updated += updated
+			result.Inserted += min(session.RowsAffected-2*updated, size-updated)
+		}
+	}
+
+	result.CountsReported = countsReported
+	return result, nil
+}
@@ -0,0 +1,245 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alioth-center/infrastructure/exit"
+)
+
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the Write until the buffer has room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the entry being written when the buffer is full.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest buffered entry to make room for the entry being written.
+	OverflowDropOldest
+)
+
+// AsyncConfig is the config of the async writer, the zero values use the defaults.
+type AsyncConfig struct {
+	// BufferSize is the count of the entries buffered, 1024 by default.
+	BufferSize int
+	// BatchCount is the count of the entries written in a batch, 128 by default.
+	BatchCount int
+	// BatchBytes is the bytes of the entries written in a batch, 64KiB by default.
+	BatchBytes int
+	// FlushInterval is the max duration the entries stay in the batch, 100ms by default.
+	FlushInterval time.Duration
+	// Overflow is the policy when the buffer is full, OverflowBlock by default.
+	Overflow OverflowPolicy
+}
+
+// AsyncWriter buffers the entries and writes them to the wrapped writer in batches, a batch is written when it
+// reaches the count or the bytes, or the flush interval elapses. The buffered entries are flushed when the
+// writer is closed or the process exits.
+type AsyncWriter struct {
+	writer  Writer
+	config  AsyncConfig
+	entries chan []byte
+	flushes chan chan struct{}
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  atomic.Bool
+	dropped atomic.Uint64
+}
+
+// NewAsyncWriter wraps the writer with the async writer, the wrapped writer receives the batches instead of the
+// entries, so it should write them directly without buffering them again.
+//
+// Parameters:
+//
+//	writer (Writer): The writer receiving the batches.
+//	config (AsyncConfig): The config of the buffer, the batches and the overflow policy.
+//
+// Returns:
+//
+//	*AsyncWriter: The async writer, which closes the wrapped writer when it is closed.
+//
+// example:
+//
+//	writer := logger.NewAsyncWriter(logger.NewStdoutConsoleWriter(), logger.AsyncConfig{Overflow: logger.OverflowDropOldest})
+//	log := logger.NewCustomLoggerWithOpts(logger.WithCustomWriterOpts(writer))
+func NewAsyncWriter(writer Writer, config AsyncConfig) *AsyncWriter {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1024
+	}
+	if config.BatchCount <= 0 {
+		config.BatchCount = 128
+	}
+	if config.BatchBytes <= 0 {
+		config.BatchBytes = 64 << 10
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 100 * time.Millisecond
+	}
+
+	w := &AsyncWriter{
+		writer:  writer,
+		config:  config,
+		entries: make(chan []byte, config.BufferSize),
+		flushes: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	exit.RegisterExitEvent(func(_ os.Signal) {
+		w.Close()
+	}, fmt.Sprintf("EXIT_ASYNC_LOGGER:%p", w))
+	go w.serve()
+
+	return w
+}
+
+// NewAsyncFileWriter creates the async writer writing the batches into the file directly, a batch is written
+// by a single syscall. The writers are shared by the path like NewFileWriter.
+//
+// example:
+//
+//	log := logger.NewCustomLoggerWithOpts(logger.WithCustomWriterOpts(logger.NewAsyncFileWriter("app.log", logger.AsyncConfig{})))
+func NewAsyncFileWriter(path string, config AsyncConfig) Writer {
+	// exist file writer, return it
+	if w, ok := fileWriters.Get(path); ok {
+		return w
+	}
+
+	f, e := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o666)
+	if e != nil {
+		return nil
+	}
+
+	w := NewAsyncWriter(directFileWriter{f: f}, config)
+	fileWriters.Set(path, w)
+
+	return w
+}
+
+func (w *AsyncWriter) Write(data []byte) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed.Load() {
+		return
+	}
+
+	switch w.config.Overflow {
+	case OverflowDropNewest:
+		select {
+		case w.entries <- data:
+		default:
+			w.dropped.Add(1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case w.entries <- data:
+				return
+			default:
+			}
+
+			select {
+			case <-w.entries:
+				w.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		w.entries <- data
+	}
+}
+
+// Flush writes the buffered entries to the wrapped writer, and returns after they are written.
+func (w *AsyncWriter) Flush() {
+	w.mu.RLock()
+	if w.closed.Load() {
+		w.mu.RUnlock()
+		return
+	}
+
+	flushed := make(chan struct{})
+	w.flushes <- flushed
+	w.mu.RUnlock()
+	<-flushed
+}
+
+// Close flushes the buffered entries and closes the wrapped writer.
+func (w *AsyncWriter) Close() {
+	w.mu.Lock()
+	if w.closed.Swap(true) {
+		w.mu.Unlock()
+		return
+	}
+	close(w.entries)
+	w.mu.Unlock()
+
+	<-w.done
+	w.writer.Close()
+}
+
+// Dropped returns the count of the entries dropped by the overflow policy.
+func (w *AsyncWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+func (w *AsyncWriter) serve() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch, count := &bytes.Buffer{}, 0
+	flush := func() {
+		if count > 0 {
+			// the wrapped writer may keep the batch, such as the file writer buffering it
+			w.writer.Write(bytes.Clone(batch.Bytes()))
+			batch.Reset()
+			count = 0
+		}
+	}
+	add := func(data []byte) {
+		batch.Write(data)
+		if count++; count >= w.config.BatchCount || batch.Len() >= w.config.BatchBytes {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case data, ok := <-w.entries:
+			if !ok {
+				flush()
+				return
+			}
+			add(data)
+		case <-ticker.C:
+			flush()
+		case flushed := <-w.flushes:
+			for pending := len(w.entries); pending > 0; pending-- {
+				data, ok := <-w.entries
+				if !ok {
+					break
+				}
+				add(data)
+			}
+			flush()
+			close(flushed)
+		}
+	}
+}
+
+// directFileWriter writes the data into the file synchronously, it is wrapped by the async writer.
+type directFileWriter struct {
+	f *os.File
+}
+
+func (d directFileWriter) Write(data []byte) {
+	_, _ = d.f.Write(data)
+}
+
+func (d directFileWriter) Close() {
+	_ = d.f.Close()
+}
@@ -3,6 +3,7 @@ package logger
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -10,26 +11,30 @@ const (
 	serviceEnvKey   = "AC_SERVICE"
 	extraFieldsKey  = "AC_EXTRA_FIELDS"
 	pkgDirectoryKey = "AC_PKG_DIR"
+	redactKey       = "AC_LOG_REDACT"
 )
 
 var (
 	serviceEnv   string
 	extraFields  string
 	pkgDirectory string
+	redactEnv    bool
 )
 
 func init() {
 	serviceEnv = os.Getenv(serviceEnvKey)
 	extraFields = os.Getenv(extraFieldsKey)
 	pkgDirectory = os.Getenv(pkgDirectoryKey)
+	redactEnv, _ = strconv.ParseBool(os.Getenv(redactKey))
 }
 
 // NewCustomLoggerWithOpts creates and returns a new custom logger instance
 // with the specified options. This function initializes a custom logger
 // with default values and then applies the provided options to it.
 //
-// The logger is configured with default options for standard writer, JSON
-// formatting, and log level set to Info. Additional options can be passed
+// The logger is configured with default options for standard writer, the
+// format selected by the env AC_LOG_FORMAT (json, text or logfmt, JSON by
+// default), and log level set to Info. Additional options can be passed
 // and will be applied in the order they are provided.
 //
 // Parameters:
@@ -48,11 +53,17 @@ func NewCustomLoggerWithOpts(opts ...Option) Logger {
 	}
 
 	// Apply default options before any user-provided options
-	opts = append([]Option{
+	defaults := []Option{
 		WithStdWriterOpts(),
-		WithJsonFormatOpts(),
+		withEnvFormatOpts(),
 		WithLevelOpts(LevelInfo),
-	}, opts...)
+	}
+
+	// Redact the sensitive data if the env enables it, the redactor of the options takes precedence
+	if redactEnv {
+		defaults = append(defaults, WithRedactorOpts(NewRedactor()))
+	}
+	opts = append(defaults, opts...)
 
 	// Inject service field
 	attachField := NewFields()
@@ -94,6 +105,10 @@ type customLogger struct {
 	marshaller func(Fields) []byte
 	writer     Writer
 	attach     Fields
+	format     formatConfig
+	levels     *AtomicLevel
+	redactor   *Redactor
+	sampler    *sampler
 }
 
 func (c customLogger) Debug(fields Fields) {
@@ -152,14 +167,71 @@ func (c customLogger) Panicf(fields Fields, format string, args ...any) {
 	c.log(LevelPanic, fields.WithMessage(fmt.Sprintf(format, args...)).WithLevel(LevelPanic))
 }
 
-func (c customLogger) log(level Level, fields Fields) {
-	if c.level.shouldLog(level) {
-		callbacks := c.hooks[level]
-		if c.attach != nil {
-			fields = fields.WithAttachFields(c.attach)
+func (c customLogger) enabled(level Level) bool {
+	if c.levels != nil {
+		return c.levels.enabledAny(level)
+	}
+
+	return c.level.shouldLog(level)
+}
+
+func (c customLogger) shouldLog(level Level, entry Fields) bool {
+	if c.levels == nil {
+		return c.level.shouldLog(level)
+	}
+
+	var service, file string
+	if f, ok := entry.(*fields); ok {
+		service, file = f.service, f.file
+	}
+	if service == "" && c.attach != nil {
+		if attach, ok := c.attach.(*fields); ok {
+			service = attach.service
 		}
-		for _, callback := range callbacks {
-			go callback(fields)
+	}
+
+	return c.levels.Enabled(level, service, file)
+}
+
+func (c customLogger) log(level Level, fields Fields) {
+	if !c.shouldLog(level, fields) {
+		return
+	}
+
+	if c.sampler != nil && !c.sample(level, fields) {
+		return
+	}
+
+	c.write(level, fields)
+}
+
+func (c customLogger) sample(level Level, entry Fields) bool {
+	if f, ok := entry.(*fields); ok {
+		return c.sampler.sample(level, f.message, f.file)
+	}
+
+	return true
+}
+
+func (c customLogger) write(level Level, entry Fields) {
+	callbacks := c.hooks[level]
+	if c.attach != nil {
+		entry = entry.WithAttachFields(c.attach)
+	}
+	if c.redactor != nil {
+		entry = c.redactor.Redact(entry)
+	}
+
+	// the hooks run concurrently, every hook receives its own copy with the trace context resolved
+	f, ok := entry.(*fields)
+	if ok {
+		f.resolve()
+	}
+	for _, callback := range callbacks {
+		if ok {
+			go callback(f.clone())
+		} else {
+			go callback(entry)
 		}
 	}
 }
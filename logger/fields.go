@@ -2,6 +2,7 @@ package logger
 
 import (
 	"context"
+	"maps"
 	"strings"
 	"time"
 
@@ -90,23 +91,38 @@ func (f *fields) trimFile() {
 	}
 }
 
-// Export 导出日志字段
+// Export 导出日志字段，不修改字段本身，可以并发调用
 func (f *fields) Export() *Entry {
 	traceID, ctx := trace.TransformContext(f.ctx)
-	f.ctx = ctx
 
 	return &Entry{
-		ctx:     f.ctx,
-		File:    f.file,
-		Level:   string(f.level),
-		Service: f.service,
-		TraceID: traceID,
-		Message: f.message,
-		Data:    f.data,
-		Extra:   f.extra,
+		ctx:      ctx,
+		File:     f.file,
+		Level:    string(f.level),
+		Service:  f.service,
+		TraceID:  traceID,
+		CallTime: f.callTime,
+		Message:  f.message,
+		Data:     f.data,
+		Extra:    f.extra,
 	}
 }
 
+// resolve 解析 trace 上下文，保证多次导出的 traceId 一致
+func (f *fields) resolve() {
+	f.ctx = trace.FromContext(f.ctx)
+}
+
+// clone 复制日志字段，extra 被复制，其他值被共享
+func (f *fields) clone() *fields {
+	cloned := *f
+	if f.extra != nil {
+		cloned.extra = maps.Clone(f.extra)
+	}
+
+	return &cloned
+}
+
 // WithTraceID 设置 traceId，如果 traceId 已存在则无效
 func (f *fields) WithTraceID(traceId string) Fields {
 	if f.ctx.Value(trace.ContextKey()) != nil {
@@ -0,0 +1,221 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	logFormatEnvKey = "AC_LOG_FORMAT"
+	noColorEnvKey   = "NO_COLOR"
+
+	FormatJson   = "json"
+	FormatText   = "text"
+	FormatLogfmt = "logfmt"
+)
+
+// textMessageWidth is the width the messages are padded to, so the fields of the short messages are aligned.
+const textMessageWidth = 40
+
+var levelColors = map[Level]string{
+	LevelDebug: "\033[90m",
+	LevelInfo:  "\033[32m",
+	LevelWarn:  "\033[33m",
+	LevelError: "\033[31m",
+	LevelFatal: "\033[35m",
+	LevelPanic: "\033[35m",
+}
+
+// formatConfig is the config of the text and logfmt marshallers, read when the logs are marshalled, so the
+// options can be applied in any order.
+type formatConfig struct {
+	timeFormat string
+	color      *bool
+}
+
+// WithTextFormatOpts formats the logs as the human-readable lines for the local development, the levels are
+// colored when the logs are written to a terminal, and the data is pretty-printed in the following lines.
+//
+// example:
+//
+//	2024.01.02-15:04:05.000+08:00 INFO  user created                             user_id=1 trace_id=... file=main.go:20
+func WithTextFormatOpts() Option {
+	return func(c *customLogger) {
+		c.marshaller = func(fields Fields) []byte { return textMarshaller(fields, c.format.timeFormat, c.colored()) }
+	}
+}
+
+// WithLogfmtFormatOpts formats the logs as logfmt, the key=value pairs in a line.
+//
+// example:
+//
+//	time=2024.01.02-15:04:05.000+08:00 level=info msg="user created" user_id=1 trace_id=... file=main.go:20
+func WithLogfmtFormatOpts() Option {
+	return func(c *customLogger) {
+		c.marshaller = func(fields Fields) []byte { return logfmtMarshaller(fields, c.format.timeFormat) }
+	}
+}
+
+// WithTimeFormatOpts sets the time layout of the text and logfmt formats.
+func WithTimeFormatOpts(layout string) Option {
+	return func(c *customLogger) {
+		c.format.timeFormat = layout
+	}
+}
+
+// WithColorOpts enables or disables the colored levels of the text format, which are enabled only for the
+// terminals by default.
+func WithColorOpts(enabled bool) Option {
+	return func(c *customLogger) {
+		c.format.color = &enabled
+	}
+}
+
+// withEnvFormatOpts selects the format by the env AC_LOG_FORMAT, json by default.
+func withEnvFormatOpts() Option {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(logFormatEnvKey))) {
+	case FormatText:
+		return WithTextFormatOpts()
+	case FormatLogfmt:
+		return WithLogfmtFormatOpts()
+	default:
+		return WithJsonFormatOpts()
+	}
+}
+
+// colored reports whether the levels are colored, they are colored by default if the logger writes to a
+// terminal and the env NO_COLOR is not set.
+func (c *customLogger) colored() bool {
+	if c.format.color != nil {
+		return *c.format.color
+	}
+
+	console, isConsole := c.writer.(consoleWriter)
+	return isConsole && os.Getenv(noColorEnvKey) == "" && isTerminal(console.console)
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func textMarshaller(fields Fields, timeLayout string, colored bool) []byte {
+	entry := fields.Export()
+	buffer := &bytes.Buffer{}
+
+	buffer.WriteString(formatCallTime(entry.CallTime, timeLayout))
+	buffer.WriteByte(' ')
+
+	level := Level(entry.Level)
+	if level == "" {
+		level = LevelInfo
+	}
+	if colored {
+		buffer.WriteString(levelColors[level])
+	}
+	fmt.Fprintf(buffer, "%-5s", strings.ToUpper(string(level)))
+	if colored {
+		buffer.WriteString("\033[0m")
+	}
+	buffer.WriteByte(' ')
+
+	fmt.Fprintf(buffer, "%-*s", textMessageWidth, entry.Message)
+	for _, pair := range entryPairs(entry) {
+		buffer.WriteByte(' ')
+		buffer.WriteString(pair[0])
+		buffer.WriteByte('=')
+		buffer.WriteString(quoteLogfmt(pair[1]))
+	}
+	buffer.WriteByte('\n')
+
+	if entry.Data != nil {
+		data, err := json.MarshalIndent(entry.Data, "    ", "  ")
+		if err != nil {
+			data = []byte(fmt.Sprint(entry.Data))
+		}
+		buffer.WriteString("    ")
+		buffer.Write(data)
+		buffer.WriteByte('\n')
+	}
+
+	return buffer.Bytes()
+}
+
+func logfmtMarshaller(fields Fields, timeLayout string) []byte {
+	entry := fields.Export()
+	buffer := &bytes.Buffer{}
+
+	level := entry.Level
+	if level == "" {
+		level = string(LevelInfo)
+	}
+	buffer.WriteString("time=" + quoteLogfmt(formatCallTime(entry.CallTime, timeLayout)))
+	buffer.WriteString(" level=" + level)
+	if entry.Message != "" {
+		buffer.WriteString(" msg=" + quoteLogfmt(entry.Message))
+	}
+	for _, pair := range entryPairs(entry) {
+		buffer.WriteString(" " + pair[0] + "=" + quoteLogfmt(pair[1]))
+	}
+	if entry.Data != nil {
+		data, err := json.Marshal(entry.Data)
+		if err != nil {
+			data = []byte(fmt.Sprint(entry.Data))
+		}
+		buffer.WriteString(" data=" + quoteLogfmt(string(data)))
+	}
+	buffer.WriteByte('\n')
+
+	return buffer.Bytes()
+}
+
+// entryPairs returns the extra fields sorted by the keys, followed by the service, trace id and file.
+func entryPairs(entry *Entry) (pairs [][2]string) {
+	keys := make([]string, 0, len(entry.Extra))
+	for key := range entry.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		pairs = append(pairs, [2]string{key, fmt.Sprint(entry.Extra[key])})
+	}
+	if entry.Service != "" {
+		pairs = append(pairs, [2]string{"service", entry.Service})
+	}
+	if entry.TraceID != "" {
+		pairs = append(pairs, [2]string{"trace_id", entry.TraceID})
+	}
+	if entry.File != "" {
+		pairs = append(pairs, [2]string{"file", entry.File})
+	}
+
+	return pairs
+}
+
+// formatCallTime formats the call time of the entry with the layout, the current time is used if it is unset.
+func formatCallTime(callTime, layout string) string {
+	if layout == "" {
+		layout = timeFormat
+	}
+
+	called := time.Now()
+	if parsed, err := time.Parse(timeFormat, callTime); callTime != "" && err == nil {
+		called = parsed
+	}
+
+	return called.Format(layout)
+}
+
+func quoteLogfmt(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t\r\n") {
+		return fmt.Sprintf("%q", value)
+	}
+
+	return value
+}
@@ -1,6 +1,6 @@
 package logger
 
-var defaultLogger = NewCustomLoggerWithOpts()
+var defaultLogger = NewCustomLoggerWithOpts(WithAtomicLevelOpts(defaultAtomicLevel))
 
 // Log logs a message at the specified level with the given fields.
 //
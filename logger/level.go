@@ -0,0 +1,231 @@
+package logger
+
+import (
+	"cmp"
+	"errors"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrInvalidLevel = errors.New("invalid log level")
+
+var defaultAtomicLevel = NewAtomicLevel(LevelInfo)
+
+// ParseLevel parses the level name case-insensitively.
+func ParseLevel(level string) (Level, error) {
+	parsed := Level(strings.ToLower(strings.TrimSpace(level)))
+	if _, exist := LevelValueMap[parsed]; !exist {
+		return "", ErrInvalidLevel
+	}
+
+	return parsed, nil
+}
+
+// AtomicLevel is the level shared by the loggers, which can be changed at runtime. The level can be overridden
+// for the services and the packages, the override of a name applies to the logs of the service with the name,
+// or the logs written in the package whose import path is or ends with the name.
+type AtomicLevel struct {
+	level     atomic.Value
+	overrides atomic.Pointer[levelOverrides]
+
+	mu      sync.Mutex
+	reverts map[string]*time.Timer
+	restore *Level
+}
+
+// NewAtomicLevel creates the level holder with the initial level.
+//
+// example:
+//
+//	level := logger.NewAtomicLevel(logger.LevelInfo)
+//	log := logger.NewCustomLoggerWithOpts(logger.WithAtomicLevelOpts(level))
+//
+//	// debug the database package for ten minutes
+//	level.SetOverride("database", logger.LevelDebug, 10*time.Minute)
+func NewAtomicLevel(level Level) *AtomicLevel {
+	a := &AtomicLevel{reverts: map[string]*time.Timer{}}
+	a.level.Store(level)
+	a.overrides.Store(newLevelOverrides(map[string]Level{}))
+	return a
+}
+
+// DefaultAtomicLevel returns the level holder of the default logger.
+func DefaultAtomicLevel() *AtomicLevel {
+	return defaultAtomicLevel
+}
+
+// Level returns the current level without the overrides.
+func (a *AtomicLevel) Level() Level {
+	return a.level.Load().(Level)
+}
+
+// Overrides returns a copy of the current overrides.
+func (a *AtomicLevel) Overrides() map[string]Level {
+	return maps.Clone(a.overrides.Load().levels)
+}
+
+// SetLevel changes the level, it is reverted after revertAfter if revertAfter is greater than zero. The temporary
+// changes are reverted to the level before the first of them, and the permanent change cancels the pending revert.
+func (a *AtomicLevel) SetLevel(level Level, revertAfter time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if revertAfter <= 0 {
+		a.restore = nil
+	} else if a.restore == nil {
+		current := a.Level()
+		a.restore = &current
+	}
+
+	a.level.Store(level)
+	a.scheduleRevert("", revertAfter, func() {
+		a.level.Store(*a.restore)
+		a.restore = nil
+	})
+}
+
+// Revert reverts the temporary level changed by SetLevel immediately.
+func (a *AtomicLevel) Revert() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.scheduleRevert("", 0, nil)
+	if a.restore != nil {
+		a.level.Store(*a.restore)
+		a.restore = nil
+	}
+}
+
+// SetOverride overrides the level of the service or the package, it is removed after revertAfter if revertAfter
+// is greater than zero.
+func (a *AtomicLevel) SetOverride(name string, level Level, revertAfter time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	overrides := maps.Clone(a.overrides.Load().levels)
+	overrides[name] = level
+	a.overrides.Store(newLevelOverrides(overrides))
+	a.scheduleRevert(name, revertAfter, func() { a.removeOverride(name) })
+}
+
+// RemoveOverride removes the override of the service or the package.
+func (a *AtomicLevel) RemoveOverride(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.scheduleRevert(name, 0, nil)
+	a.removeOverride(name)
+}
+
+func (a *AtomicLevel) removeOverride(name string) {
+	overrides := maps.Clone(a.overrides.Load().levels)
+	delete(overrides, name)
+	a.overrides.Store(newLevelOverrides(overrides))
+}
+
+// scheduleRevert replaces the pending revert of the key, the override keys are the names and the level key is
+// empty. It must be called with the lock held.
+func (a *AtomicLevel) scheduleRevert(key string, revertAfter time.Duration, revert func()) {
+	if timer, exist := a.reverts[key]; exist {
+		timer.Stop()
+		delete(a.reverts, key)
+	}
+	if revertAfter <= 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(revertAfter, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		// the revert is replaced after the timer fired
+		if a.reverts[key] != timer {
+			return
+		}
+		delete(a.reverts, key)
+		revert()
+	})
+	a.reverts[key] = timer
+}
+
+// Enabled reports whether the log of the level is written, the override of the service or the most specific
+// override matching the package of the caller file replaces the level. The deeper packages are matched first,
+// and the longer names are matched first in the same package, so "infrastructure/database" takes precedence
+// over "database" for github.com/alioth-center/infrastructure/database.
+func (a *AtomicLevel) Enabled(level Level, service, file string) bool {
+	overrides := a.overrides.Load()
+	if len(overrides.sorted) > 0 {
+		if override, exist := overrides.levels[service]; exist && service != "" {
+			return override.shouldLog(level)
+		}
+
+		for pkg := packageOf(file); pkg != "." && pkg != "/" && pkg != ""; pkg = path.Dir(pkg) {
+			for _, override := range overrides.sorted {
+				if pkg == override.name || strings.HasSuffix(pkg, "/"+override.name) {
+					return override.level.shouldLog(level)
+				}
+			}
+		}
+	}
+
+	return a.Level().shouldLog(level)
+}
+
+// enabledAny reports whether the level is enabled by the level or any override, which is used when the caller
+// is unknown.
+func (a *AtomicLevel) enabledAny(level Level) bool {
+	if a.Level().shouldLog(level) {
+		return true
+	}
+
+	for _, override := range a.overrides.Load().sorted {
+		if override.level.shouldLog(level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// levelOverrides is the snapshot of the overrides, which is replaced instead of modified. The names are sorted
+// from the longest when the snapshot is built, so the logs do not sort them.
+type levelOverrides struct {
+	levels map[string]Level
+	sorted []levelOverride
+}
+
+type levelOverride struct {
+	name  string
+	level Level
+}
+
+func newLevelOverrides(levels map[string]Level) *levelOverrides {
+	sorted := make([]levelOverride, 0, len(levels))
+	for name, level := range levels {
+		sorted = append(sorted, levelOverride{name: name, level: level})
+	}
+	slices.SortFunc(sorted, func(a, b levelOverride) int {
+		if byLength := cmp.Compare(len(b.name), len(a.name)); byLength != 0 {
+			return byLength
+		}
+		return strings.Compare(a.name, b.name)
+	})
+
+	return &levelOverrides{levels: levels, sorted: sorted}
+}
+
+// packageOf returns the directory of the caller file, such as github.com/alioth-center/infrastructure/database
+// for github.com/alioth-center/infrastructure/database/implement.go:120.
+func packageOf(file string) string {
+	if colon := strings.LastIndex(file, ":"); colon > 0 {
+		file = file[:colon]
+	}
+
+	return path.Dir(file)
+}
@@ -11,6 +11,15 @@ func WithJsonFormatOpts() Option {
 func WithLevelOpts(level Level) Option {
 	return func(c *customLogger) {
 		c.level = level
+		c.levels = nil
+	}
+}
+
+// WithAtomicLevelOpts shares the level holder with the logger, the level and the overrides of the holder
+// changed at runtime apply to the logger.
+func WithAtomicLevelOpts(levels *AtomicLevel) Option {
+	return func(c *customLogger) {
+		c.levels = levels
 	}
 }
 
@@ -26,6 +35,12 @@ func WithFileWriterOpts(file string) Option {
 	}
 }
 
+func WithRotationFileWriterOpts(path string, config RotationConfig) Option {
+	return func(c *customLogger) {
+		c.writer = NewSizeBasedRotationFileWriter(path, config)
+	}
+}
+
 func WithCustomWriterOpts(writer Writer) Option {
 	return func(c *customLogger) {
 		c.writer = writer
@@ -57,3 +72,11 @@ func WithAttachFields(fields Fields) Option {
 		logger.attach = logger.attach.WithAttachFields(fields)
 	}
 }
+
+// WithRedactorOpts redacts the sensitive data of the logs by the redactor before they are written, the redaction
+// is also enabled by the env AC_LOG_REDACT=true with the default rules.
+func WithRedactorOpts(redactor *Redactor) Option {
+	return func(c *customLogger) {
+		c.redactor = redactor
+	}
+}
@@ -0,0 +1,322 @@
+package logger
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alioth-center/infrastructure/utils/values"
+)
+
+const (
+	redactTagKey   = "log"
+	redactTagValue = "redact"
+	redactMaxDepth = 16
+	redactMaskChar = "*"
+)
+
+var (
+	defaultRedactKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "apikey", "accesskey", "privatekey", "credential"}
+
+	EmailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	PhonePattern      = regexp.MustCompile(`(?:\+[1-9]\d{7,14}\b)|(?:\b1[3-9]\d{9}\b)`)
+	CardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+type valueRule struct {
+	pattern  *regexp.Regexp
+	validate func(match string) bool
+}
+
+// Redactor masks the sensitive data of the log fields, the values of the keys matching the key rules and the
+// struct fields tagged with log:"redact" are masked entirely, and the parts of the strings matching the value
+// rules are masked with the prefix and the suffix displayed.
+type Redactor struct {
+	keys          []string
+	rules         []valueRule
+	displayPrefix int
+	displaySuffix int
+}
+
+type RedactorOption func(*Redactor)
+
+// WithRedactKeysOpts adds the key rules, the keys containing the rules are redacted, the case, '-' and '_' are
+// ignored, so the rule "api_key" matches "X-Api-Key".
+func WithRedactKeysOpts(keys ...string) RedactorOption {
+	return func(r *Redactor) {
+		for _, key := range keys {
+			r.keys = append(r.keys, normalizeRedactKey(key))
+		}
+	}
+}
+
+// WithRedactPatternsOpts adds the value rules, the parts of the strings matching the patterns are redacted.
+func WithRedactPatternsOpts(patterns ...*regexp.Regexp) RedactorOption {
+	return func(r *Redactor) {
+		for _, pattern := range patterns {
+			r.rules = append(r.rules, valueRule{pattern: pattern})
+		}
+	}
+}
+
+// WithRedactDisplayOpts sets the count of the characters displayed at the beginning and the end of the parts
+// matching the value rules, 3 and 4 by default, such as 138****5678.
+func WithRedactDisplayOpts(prefix, suffix int) RedactorOption {
+	return func(r *Redactor) {
+		r.displayPrefix, r.displaySuffix = prefix, suffix
+	}
+}
+
+// NewRedactor creates the redactor with the default rules, which redact the keys like password, token and
+// authorization, and the emails, phone numbers and card numbers in the strings.
+//
+// example:
+//
+//	redactor := logger.NewRedactor(logger.WithRedactKeysOpts("id_card"), logger.WithRedactPatternsOpts(ipPattern))
+//	log := logger.NewCustomLoggerWithOpts(logger.WithRedactorOpts(redactor))
+func NewRedactor(opts ...RedactorOption) *Redactor {
+	r := &Redactor{
+		keys: append([]string{}, defaultRedactKeys...),
+		rules: []valueRule{
+			{pattern: EmailPattern},
+			{pattern: PhonePattern},
+			{pattern: CardNumberPattern, validate: luhnValid},
+		},
+		displayPrefix: 3,
+		displaySuffix: 4,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(r)
+		}
+	}
+
+	return r
+}
+
+// Redact redacts the message, the data and the extra fields into a copy of the fields, the fields of the caller
+// are not modified.
+func (r *Redactor) Redact(entry Fields) Fields {
+	f, ok := entry.(*fields)
+	if !ok {
+		return entry
+	}
+
+	redacted := f.clone()
+	redacted.message = r.RedactString(f.message)
+	if f.data != nil {
+		redacted.data = r.redactValue(reflect.ValueOf(f.data), 0)
+	}
+	for key, value := range f.extra {
+		redacted.extra[key] = r.redactKeyValue(key, reflect.ValueOf(value), 0)
+	}
+
+	return redacted
+}
+
+// RedactString masks the parts of the string matching the value rules.
+func (r *Redactor) RedactString(raw string) string {
+	for _, rule := range r.rules {
+		raw = rule.pattern.ReplaceAllStringFunc(raw, func(match string) string {
+			if rule.validate != nil && !rule.validate(match) {
+				return match
+			}
+
+			return r.mask(match, r.displayPrefix, r.displaySuffix)
+		})
+	}
+
+	return raw
+}
+
+func (r *Redactor) mask(raw string, prefix, suffix int) string {
+	if length := len([]rune(raw)); length <= prefix+suffix {
+		prefix, suffix = 0, 0
+	}
+
+	return values.SecretString(raw, prefix, suffix, redactMaskChar)
+}
+
+func (r *Redactor) sensitiveKey(key string) bool {
+	normalized := normalizeRedactKey(key)
+	for _, rule := range r.keys {
+		if rule != "" && strings.Contains(normalized, rule) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Redactor) redactKeyValue(key string, value reflect.Value, depth int) any {
+	if r.sensitiveKey(key) {
+		return r.maskValue(value)
+	}
+
+	return r.redactValue(value, depth)
+}
+
+// maskValue masks the value entirely, the nil values are kept to tell the absent values.
+func (r *Redactor) maskValue(value reflect.Value) any {
+	for value.IsValid() && (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil
+	}
+
+	if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String {
+		// the multiple values of the headers, such as Authorization: [Bearer xxx]
+		masked := make([]string, value.Len())
+		for i := range masked {
+			masked[i] = r.mask(value.Index(i).String(), 0, 0)
+		}
+		return masked
+	}
+
+	if value.Kind() == reflect.String {
+		return r.mask(value.String(), 0, 0)
+	}
+
+	return r.mask(fmt.Sprint(value.Interface()), 0, 0)
+}
+
+// redactValue copies the value with the sensitive data redacted, the structs are copied as the maps keyed by
+// the json names, and the values marshalled by themselves are kept.
+func (r *Redactor) redactValue(value reflect.Value, depth int) any {
+	if !value.IsValid() {
+		return nil
+	}
+	if depth > redactMaxDepth {
+		return value.Interface()
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return value.Interface()
+		}
+		if value.Kind() == reflect.Pointer && opaqueType(value.Type()) {
+			return value.Interface()
+		}
+		return r.redactValue(value.Elem(), depth+1)
+	case reflect.String:
+		return r.RedactString(value.String())
+	case reflect.Map:
+		if value.IsNil() {
+			return value.Interface()
+		}
+		redacted := make(map[string]any, value.Len())
+		iterator := value.MapRange()
+		for iterator.Next() {
+			key := fmt.Sprint(iterator.Key().Interface())
+			redacted[key] = r.redactKeyValue(key, iterator.Value(), depth+1)
+		}
+		return redacted
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && (value.IsNil() || value.Type().Elem().Kind() == reflect.Uint8) {
+			return value.Interface()
+		}
+		redacted := make([]any, value.Len())
+		for i := range redacted {
+			redacted[i] = r.redactValue(value.Index(i), depth+1)
+		}
+		return redacted
+	case reflect.Struct:
+		if opaqueType(value.Type()) {
+			return value.Interface()
+		}
+		redacted := map[string]any{}
+		r.redactStruct(value, redacted, depth)
+		return redacted
+	default:
+		return value.Interface()
+	}
+}
+
+func (r *Redactor) redactStruct(value reflect.Value, redacted map[string]any, depth int) {
+	for i := 0; i < value.NumField(); i++ {
+		field, fieldValue := value.Type().Field(i), value.Field(i)
+		name, omitEmpty, skip := jsonFieldName(field)
+		if skip || !field.IsExported() || (omitEmpty && fieldValue.IsZero()) {
+			continue
+		}
+
+		// the embedded structs without the json names are inlined like encoding/json
+		if field.Anonymous && name == "" {
+			embedded := fieldValue
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct && !opaqueType(embedded.Type()) {
+				r.redactStruct(embedded, redacted, depth+1)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if field.Tag.Get(redactTagKey) == redactTagValue {
+			redacted[name] = r.maskValue(fieldValue)
+		} else {
+			redacted[name] = r.redactKeyValue(name, fieldValue, depth+1)
+		}
+	}
+}
+
+func jsonFieldName(field reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	name, options, _ := strings.Cut(tag, ",")
+	return name, strings.Contains(options, "omitempty"), false
+}
+
+// opaqueType reports whether the type is marshalled by itself, the redactor cannot see inside it.
+func opaqueType(t reflect.Type) bool {
+	return t == timeType || t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+func normalizeRedactKey(key string) string {
+	return strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(key))
+}
+
+// luhnValid checks the card number by the luhn algorithm, so the long numbers like the timestamps are not
+// redacted as the card numbers.
+func luhnValid(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if digit < 0 || digit > 9 {
+			continue
+		}
+
+		if double {
+			if digit *= 2; digit > 9 {
+				digit -= 9
+			}
+		}
+		sum, double = sum+digit, !double
+	}
+
+	return sum%10 == 0
+}
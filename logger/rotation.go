@@ -0,0 +1,288 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alioth-center/infrastructure/exit"
+)
+
+const rotationTimeLayout = "20060102T150405.000"
+
+// RotationConfig is the config of the size based rotation file writer, the zero values disable the features.
+type RotationConfig struct {
+	// MaxSize is the max bytes of a log file, the file is rotated before the write exceeding it.
+	MaxSize int64
+	// MaxAge is the max age of the rotated files, the older files are removed.
+	MaxAge time.Duration
+	// MaxBackups is the max count of the rotated files, the oldest files beyond it are removed.
+	MaxBackups int
+	// Compress compresses the rotated files with gzip in the background.
+	Compress bool
+	// Symlink is the path of the symlink pointing to the current log file.
+	Symlink string
+}
+
+type sizeRotationFileWriter struct {
+	path    string
+	config  RotationConfig
+	buffer  chan []byte
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  atomic.Bool
+	file    *os.File
+	current atomic.Value
+	size    int64
+	cleanMu sync.Mutex
+	cleanWg sync.WaitGroup
+}
+
+func (w *sizeRotationFileWriter) Write(data []byte) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.closed.Load() {
+		w.buffer <- data
+	}
+}
+
+// Close flushes the buffered logs, closes the current file and waits for the compression of the rotated files.
+func (w *sizeRotationFileWriter) Close() {
+	w.mu.Lock()
+	if w.closed.Swap(true) {
+		w.mu.Unlock()
+		return
+	}
+	close(w.buffer)
+	w.mu.Unlock()
+
+	<-w.done
+	if w.file != nil {
+		_ = w.file.Close()
+	}
+	w.cleanWg.Wait()
+	fileWriters.Delete(w.path)
+}
+
+func (w *sizeRotationFileWriter) serve() {
+	exit.RegisterExitEvent(func(_ os.Signal) {
+		w.Close()
+	}, "EXIT_ROTATION_FILE_LOGGER:"+w.path)
+
+	for data := range w.buffer {
+		w.write(data)
+	}
+	close(w.done)
+}
+
+func (w *sizeRotationFileWriter) write(data []byte) {
+	if w.file != nil && w.config.MaxSize > 0 && w.size > 0 && w.size+int64(len(data)) > w.config.MaxSize {
+		rotated := w.file.Name()
+		_ = w.file.Close()
+		w.file = nil
+		w.maintain(rotated)
+	}
+
+	if w.file == nil && w.open(time.Now()) != nil {
+		// the log is dropped if the file cannot be opened, the same as the file writer
+		return
+	}
+
+	n, _ := w.file.Write(data)
+	w.size += int64(n)
+}
+
+// open creates the new log file named by the time, and points the symlink to it.
+func (w *sizeRotationFileWriter) open(now time.Time) (err error) {
+	var file *os.File
+	for attempt := 0; attempt < 1000; attempt++ {
+		// the files rotated in the same millisecond are named by the following milliseconds
+		name := w.backupName(now.Add(time.Duration(attempt) * time.Millisecond))
+		file, err = os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o666)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	w.file, w.size = file, 0
+	w.current.Store(filepath.Base(file.Name()))
+	if w.config.Symlink != "" && !isRegularFile(w.config.Symlink) {
+		target, relErr := filepath.Rel(filepath.Dir(w.config.Symlink), file.Name())
+		if relErr != nil {
+			target, _ = filepath.Abs(file.Name())
+		}
+
+		// replace the symlink atomically, the readers following it never see it missing
+		temporary := w.config.Symlink + ".tmp"
+		_ = os.Remove(temporary)
+		if os.Symlink(target, temporary) == nil {
+			_ = os.Rename(temporary, w.config.Symlink)
+		}
+	}
+
+	return nil
+}
+
+// maintain compresses the rotated file and removes the expired files in the background.
+func (w *sizeRotationFileWriter) maintain(rotated string) {
+	w.cleanWg.Add(1)
+	go func() {
+		defer w.cleanWg.Done()
+		w.cleanMu.Lock()
+		defer w.cleanMu.Unlock()
+
+		if rotated != "" && w.config.Compress {
+			_ = compressFile(rotated)
+		}
+		w.cleanup()
+	}()
+}
+
+func (w *sizeRotationFileWriter) cleanup() {
+	if w.config.MaxBackups <= 0 && w.config.MaxAge <= 0 {
+		return
+	}
+
+	type backup struct {
+		path    string
+		rotated time.Time
+	}
+
+	directory, base, ext := w.splitPath()
+	entries, readErr := os.ReadDir(directory)
+	if readErr != nil {
+		return
+	}
+
+	current, _ := w.current.Load().(string)
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == current || !strings.HasPrefix(name, base+"-") {
+			continue
+		}
+
+		timestamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, base+"-"), ".gz"), ext)
+		rotated, parseErr := time.ParseInLocation(rotationTimeLayout, timestamp, time.Local)
+		if parseErr != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(directory, name), rotated: rotated})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotated.After(backups[j].rotated) })
+	for i, expired := range backups {
+		if (w.config.MaxBackups > 0 && i >= w.config.MaxBackups) || (w.config.MaxAge > 0 && time.Since(expired.rotated) > w.config.MaxAge) {
+			_ = os.Remove(expired.path)
+		}
+	}
+}
+
+// backupName returns the name of the log file created at the time, such as logs/app-20240102T150405.000.log.
+func (w *sizeRotationFileWriter) backupName(created time.Time) string {
+	directory, base, ext := w.splitPath()
+	return filepath.Join(directory, base+"-"+created.Format(rotationTimeLayout)+ext)
+}
+
+func (w *sizeRotationFileWriter) splitPath() (directory, base, ext string) {
+	ext = filepath.Ext(w.path)
+	return filepath.Dir(w.path), strings.TrimSuffix(filepath.Base(w.path), ext), ext
+}
+
+// isRegularFile reports whether the path is a regular file, which is not replaced by the symlink.
+func isRegularFile(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func compressFile(path string) (err error) {
+	source, openErr := os.Open(path)
+	if openErr != nil {
+		return openErr
+	}
+	defer source.Close()
+
+	target, createErr := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o666)
+	if createErr != nil {
+		return createErr
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(target.Name())
+		}
+	}()
+
+	compressor := gzip.NewWriter(target)
+	if _, err = io.Copy(compressor, source); err != nil {
+		_ = target.Close()
+		return err
+	}
+	if err = compressor.Close(); err != nil {
+		_ = target.Close()
+		return err
+	}
+	if err = target.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// NewSizeBasedRotationFileWriter creates the file writer rotating the log files by size, the log files are named
+// by the path and the time they are created, such as logs/app-20240102T150405.000.log for logs/app.log, every
+// process starts writing a new file. The rotated files are compressed and removed in the background as the config,
+// and the buffered logs are flushed when the process exits. The writers are shared by the path like NewFileWriter.
+//
+// Parameters:
+//
+//	path (string): The path of the log files, the directory is created if not exist.
+//	config (RotationConfig): The config of the rotation and the retention.
+//
+// Returns:
+//
+//	Writer: The rotation file writer, nil if the directory cannot be created.
+//
+// example:
+//
+//	writer := logger.NewSizeBasedRotationFileWriter("logs/app.log", logger.RotationConfig{
+//		MaxSize:    100 << 20,
+//		MaxAge:     7 * 24 * time.Hour,
+//		MaxBackups: 10,
+//		Compress:   true,
+//		Symlink:    "logs/app.log",
+//	})
+func NewSizeBasedRotationFileWriter(path string, config RotationConfig) Writer {
+	// exist file writer, return it
+	if w, ok := fileWriters.Get(path); ok {
+		return w
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil
+	}
+
+	w := &sizeRotationFileWriter{
+		path:   path,
+		config: config,
+		buffer: make(chan []byte, 1024),
+		done:   make(chan struct{}),
+	}
+	go w.serve()
+	// the files left by the former processes are cleaned up as well
+	w.maintain("")
+
+	fileWriters.Set(path, w)
+
+	return w
+}
@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SamplingBudget is the count of the entries logged in a window, the first entries are logged and then every
+// Thereafter-th entry is logged, the others are suppressed. Zero Thereafter suppresses all entries after First.
+type SamplingBudget struct {
+	First      int
+	Thereafter int
+}
+
+// SamplingConfig is the config of the sampling, the entries with the same level and message share a budget in
+// the window of the interval. The budgets of the levels in Levels replace the default budget.
+type SamplingConfig struct {
+	Interval time.Duration
+	Budget   SamplingBudget
+	Levels   map[Level]SamplingBudget
+}
+
+type sampleWindow struct {
+	count      int
+	suppressed int
+}
+
+type sampler struct {
+	config  SamplingConfig
+	mu      sync.Mutex
+	windows map[string]*sampleWindow
+	summary func(level Level, message, file string, suppressed int)
+}
+
+func newSampler(config SamplingConfig, summary func(level Level, message, file string, suppressed int)) *sampler {
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.Budget == (SamplingBudget{}) {
+		config.Budget = SamplingBudget{First: 100, Thereafter: 100}
+	}
+
+	return &sampler{config: config, windows: map[string]*sampleWindow{}, summary: summary}
+}
+
+// sample reports whether the entry is logged, the window of the entry starts with its first entry, and the
+// summary of the suppressed entries is logged when the window closes.
+func (s *sampler) sample(level Level, message, file string) bool {
+	budget, exist := s.config.Levels[level]
+	if !exist {
+		budget = s.config.Budget
+	}
+
+	key := string(level) + "\x00" + message
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	window, exist := s.windows[key]
+	if !exist {
+		window = &sampleWindow{}
+		s.windows[key] = window
+		time.AfterFunc(s.config.Interval, func() { s.close(key, window, level, message, file) })
+	}
+
+	window.count++
+	if window.count <= budget.First || (budget.Thereafter > 0 && (window.count-budget.First)%budget.Thereafter == 0) {
+		return true
+	}
+
+	window.suppressed++
+	return false
+}
+
+func (s *sampler) close(key string, window *sampleWindow, level Level, message, file string) {
+	s.mu.Lock()
+	if s.windows[key] == window {
+		delete(s.windows, key)
+	}
+	suppressed := window.suppressed
+	s.mu.Unlock()
+
+	if suppressed > 0 && s.summary != nil {
+		s.summary(level, message, file, suppressed)
+	}
+}
+
+// WithSamplingOpts samples the entries with the same level and message, so the identical logs of a failing
+// dependency do not flood the output. The entries suppressed in a window are reported by a summary entry
+// such as "suppressed 4821 similar entries" when the window closes.
+//
+// example:
+//
+//	log := logger.NewCustomLoggerWithOpts(logger.WithSamplingOpts(logger.SamplingConfig{
+//		Interval: time.Second,
+//		Budget:   logger.SamplingBudget{First: 10, Thereafter: 100},
+//		Levels:   map[logger.Level]logger.SamplingBudget{logger.LevelError: {First: 100, Thereafter: 10}},
+//	}))
+func WithSamplingOpts(config SamplingConfig) Option {
+	return func(c *customLogger) {
+		c.sampler = newSampler(config, func(level Level, message, file string, suppressed int) {
+			summary := NewFields().WithLevel(level).
+				WithMessage(fmt.Sprintf("suppressed %d similar entries", suppressed)).
+				WithField("sampled_message", message)
+			if f, ok := summary.(*fields); ok {
+				f.file = file
+			}
+
+			c.write(level, summary)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+
+package logger
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// HandleLevelSignal toggles the level of the holder when the process receives SIGUSR1, the first signal changes
+// the level to the given level for revertAfter, and the next signal reverts it immediately.
+//
+// Parameters:
+//
+//	levels (*AtomicLevel): The level holder to toggle, such as DefaultAtomicLevel().
+//	level (Level): The level toggled to, usually LevelDebug.
+//	revertAfter (time.Duration): The duration after which the level is reverted automatically.
+//
+// Returns:
+//
+//	stop (func()): The function stopping handling the signal.
+//
+// example:
+//
+//	stop := logger.HandleLevelSignal(logger.DefaultAtomicLevel(), logger.LevelDebug, 10*time.Minute)
+//	defer stop()
+//
+//	// kill -USR1 <pid>
+func HandleLevelSignal(levels *AtomicLevel, level Level, revertAfter time.Duration) (stop func()) {
+	signals, done := make(chan os.Signal, 1), make(chan struct{})
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				if levels.Level() != level {
+					levels.SetLevel(level, revertAfter)
+				} else {
+					levels.Revert()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
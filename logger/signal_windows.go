@@ -0,0 +1,10 @@
+//go:build windows
+
+package logger
+
+import "time"
+
+// HandleLevelSignal does nothing on windows, which does not support SIGUSR1.
+func HandleLevelSignal(_ *AtomicLevel, _ Level, _ time.Duration) (stop func()) {
+	return func() {}
+}
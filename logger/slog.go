@@ -0,0 +1,173 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"runtime"
+
+	"github.com/alioth-center/infrastructure/utils/values"
+)
+
+// slogHandler forwards the slog records into the Logger, the attrs are recorded as the extra fields, and the
+// attrs in the groups are nested in the maps named by the groups.
+type slogHandler struct {
+	logger Logger
+	groups []string
+	extra  map[string]any
+}
+
+// NewSlogHandler creates the slog.Handler forwarding the records into the logger, so the logs of the libraries
+// using log/slog are written by the logger with the trace id of the context. The levels are mapped to the
+// nearest levels of the logger, the levels above slog.LevelError are logged as LevelError.
+//
+// Parameters:
+//
+//	logger (Logger): The logger receiving the records.
+//
+// Returns:
+//
+//	slog.Handler: The handler forwarding the records.
+//
+// example:
+//
+//	slog.SetDefault(slog.New(logger.NewSlogHandler(logger.Default())))
+//	slog.InfoContext(ctx, "user created", "user_id", 1, slog.Group("request", "ip", ip))
+func NewSlogHandler(logger Logger) slog.Handler {
+	return &slogHandler{logger: logger, extra: map[string]any{}}
+}
+
+// NewSlogLogger exposes the logger as the *slog.Logger, which is passed to the libraries accepting it.
+//
+// example:
+//
+//	client := sdk.NewClient(sdk.WithLogger(logger.NewSlogLogger(logger.Default())))
+func NewSlogLogger(logger Logger) *slog.Logger {
+	return slog.New(NewSlogHandler(logger))
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if leveled, ok := h.logger.(interface{ enabled(level Level) bool }); ok {
+		return leveled.enabled(levelFromSlog(level))
+	}
+
+	return true
+}
+
+func (h *slogHandler) Handle(ctx context.Context, record slog.Record) error {
+	extra := cloneExtra(h.extra)
+	target := groupOf(extra, h.groups)
+	record.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(target, attr)
+		return true
+	})
+
+	entry := NewFields(ctx).WithMessage(record.Message)
+	if record.PC != 0 {
+		// the caller of the slog method instead of the handler
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		if f, ok := entry.(*fields); ok {
+			f.file = values.BuildStrings(frame.File, ":", values.IntToString(frame.Line))
+			f.trimFile()
+		}
+	}
+	if !record.Time.IsZero() {
+		entry = entry.WithCallTime(record.Time)
+	}
+	for key, value := range extra {
+		entry = entry.WithField(key, value)
+	}
+
+	h.logger.Log(levelFromSlog(record.Level), entry)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	extra := cloneExtra(h.extra)
+	target := groupOf(extra, h.groups)
+	for _, attr := range attrs {
+		addSlogAttr(target, attr)
+	}
+
+	return &slogHandler{logger: h.logger, groups: h.groups, extra: extra}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	groups := append(append([]string{}, h.groups...), name)
+	return &slogHandler{logger: h.logger, groups: groups, extra: h.extra}
+}
+
+func levelFromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// addSlogAttr adds the attr into the fields, the groups are nested maps and the empty attrs are ignored.
+func addSlogAttr(target map[string]any, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if attr.Key == "" && value.Kind() != slog.KindGroup {
+		return
+	}
+
+	if value.Kind() != slog.KindGroup {
+		target[attr.Key] = value.Any()
+		return
+	}
+
+	attrs := value.Group()
+	if len(attrs) == 0 {
+		return
+	}
+
+	// the attrs of the group without a key are inlined
+	group := target
+	if attr.Key != "" {
+		group = groupOf(target, []string{attr.Key})
+	}
+	for _, member := range attrs {
+		addSlogAttr(group, member)
+	}
+}
+
+// groupOf returns the nested map of the groups, the missing maps are created.
+func groupOf(extra map[string]any, groups []string) map[string]any {
+	for _, name := range groups {
+		nested, ok := extra[name].(map[string]any)
+		if !ok {
+			nested = map[string]any{}
+			extra[name] = nested
+		}
+		extra = nested
+	}
+
+	return extra
+}
+
+// cloneExtra deeply copies the nested maps of the groups, the handlers derived from the same handler do not
+// share them.
+func cloneExtra(extra map[string]any) map[string]any {
+	cloned := maps.Clone(extra)
+	for key, value := range cloned {
+		if nested, ok := value.(map[string]any); ok {
+			cloned[key] = cloneExtra(nested)
+		}
+	}
+
+	return cloned
+}
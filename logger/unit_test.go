@@ -1,7 +1,15 @@
 package logger
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -68,3 +76,349 @@ func TestFields(t *testing.T) {
 	os.Setenv("KEY2", "VALUE2")
 	NewCustomLoggerWithOpts().Error(NewFields().WithMessage("test"))
 }
+
+func TestSizeBasedRotationFileWriter(t *testing.T) {
+	directory := t.TempDir()
+	path, symlink := filepath.Join(directory, "app.log"), filepath.Join(directory, "current.log")
+	writer := NewSizeBasedRotationFileWriter(path, RotationConfig{MaxSize: 64, MaxBackups: 2, Compress: true, Symlink: symlink})
+	if shared := NewSizeBasedRotationFileWriter(path, RotationConfig{}); shared != writer {
+		t.Fatal("expected the writer to be shared by the path")
+	}
+
+	for i := 0; i < 10; i++ {
+		writer.Write([]byte("0123456789012345678901234567890\n"))
+	}
+	writer.Write([]byte("last line\n"))
+	writer.Close()
+
+	current, err := os.ReadFile(symlink)
+	if err != nil || string(current) != "last line\n" {
+		t.Fatalf("expected the symlink to point to the current file, got %q, %v", current, err)
+	}
+
+	entries, _ := os.ReadDir(directory)
+	var compressed, plain int
+	for _, entry := range entries {
+		switch name := entry.Name(); {
+		case strings.HasSuffix(name, ".log.gz"):
+			compressed++
+		case strings.HasPrefix(name, "app-") && strings.HasSuffix(name, ".log"):
+			plain++
+		}
+	}
+	if compressed != 2 || plain != 1 {
+		t.Fatalf("expected 2 compressed backups and the current file, got %d and %d", compressed, plain)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	callTime := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	fields := NewFields().WithMessage("user created").WithField("user_id", 1).WithField("name", "Alice Bob").
+		WithData(map[string]any{"age": 20}).WithCallTime(callTime).WithLevel(LevelWarn)
+
+	text := string(textMarshaller(fields, time.DateTime, false))
+	lines := strings.Split(text, "\n")
+	if !strings.HasPrefix(lines[0], "2024-01-02 15:04:05 WARN  user created                             name=\"Alice Bob\" user_id=1 trace_id=") {
+		t.Fatalf("unexpected text line: %q", lines[0])
+	}
+	if len(lines) != 5 || lines[1] != "    {" || lines[2] != `      "age": 20` {
+		t.Fatalf("expected the data to be pretty-printed, got %q", text)
+	}
+	if colored := string(textMarshaller(fields, time.DateTime, true)); !strings.Contains(colored, "\033[33mWARN \033[0m") {
+		t.Fatalf("expected the level to be colored, got %q", colored)
+	}
+
+	logfmt := string(logfmtMarshaller(fields, ""))
+	if !strings.HasPrefix(logfmt, "time=2024.01.02-15:04:05.000Z level=warn msg=\"user created\" name=\"Alice Bob\" user_id=1 trace_id=") ||
+		!strings.HasSuffix(logfmt, " data=\"{\\\"age\\\":20}\"\n") {
+		t.Fatalf("unexpected logfmt line: %q", logfmt)
+	}
+
+	os.Setenv(logFormatEnvKey, FormatLogfmt)
+	defer os.Unsetenv(logFormatEnvKey)
+	logger := NewCustomLoggerWithOpts(WithTimeFormatOpts(time.DateTime)).(*customLogger)
+	if output := string(logger.marshaller(fields)); !strings.HasPrefix(output, "time=\"2024-01-02 15:04:05\" level=warn") {
+		t.Fatalf("expected the format selected by the env, got %q", output)
+	}
+	if logger.colored() {
+		t.Fatal("expected no color for the non-terminal stdout")
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	received := make(chan Fields, 1)
+	logger := NewCustomLoggerWithOpts(WithCustomWriterOpts(NewMultiWriter()), WithLevelOpts(LevelInfo), WithHookOpts(func(fields Fields) { received <- fields }, LevelInfo, LevelWarn))
+
+	slogger := NewSlogLogger(logger).With("service_version", "1.0").WithGroup("request")
+	if slogger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("expected the debug level to be disabled")
+	}
+
+	ctx := trace.NewContext()
+	slogger.WarnContext(ctx, "slow request", "path", "/users", slog.Group("client", "ip", "127.0.0.1"))
+	entry := (<-received).Export()
+	if entry.Level != string(LevelWarn) || entry.Message != "slow request" || entry.TraceID != trace.GetTid(ctx) || !strings.Contains(entry.File, "unit_test.go") {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+
+	request, _ := entry.Extra["request"].(map[string]any)
+	client, _ := request["client"].(map[string]any)
+	if entry.Extra["service_version"] != "1.0" || request["path"] != "/users" || client["ip"] != "127.0.0.1" {
+		t.Fatalf("unexpected extra fields: %+v", entry.Extra)
+	}
+}
+
+func TestAtomicLevel(t *testing.T) {
+	levels := NewAtomicLevel(LevelInfo)
+	received := make(chan Fields, 8)
+	logger := NewCustomLoggerWithOpts(WithCustomWriterOpts(NewMultiWriter()), WithAtomicLevelOpts(levels), WithHookOpts(func(fields Fields) { received <- fields }, LevelDebug))
+
+	logger.Debug(NewFields().WithMessage("dropped"))
+	levels.SetOverride("logger", LevelDebug, 0)
+	logger.Debug(NewFields().WithMessage("package override"))
+	levels.SetOverride("logger", LevelWarn, 0)
+	levels.SetOverride("payment", LevelDebug, 0)
+	logger.Debug(NewFields().WithMessage("dropped").WithService("order"))
+	logger.Debug(NewFields().WithMessage("service override").WithService("payment"))
+	levels.RemoveOverride("logger")
+	levels.RemoveOverride("payment")
+
+	levels.SetLevel(LevelDebug, 50*time.Millisecond)
+	levels.SetLevel(LevelDebug, 50*time.Millisecond)
+	logger.Debug(NewFields().WithMessage("temporary level"))
+	time.Sleep(100 * time.Millisecond)
+	if levels.Level() != LevelInfo || len(levels.Overrides()) != 0 {
+		t.Fatalf("expected the level to be reverted, got %s, %v", levels.Level(), levels.Overrides())
+	}
+	logger.Debug(NewFields().WithMessage("dropped"))
+
+	var messages []string
+	for len(messages) < 3 {
+		select {
+		case fields := <-received:
+			messages = append(messages, fields.Export().Message)
+		case <-time.After(time.Second):
+			t.Fatalf("expected 3 logs, got %v", messages)
+		}
+	}
+	if sort.Strings(messages); strings.Join(messages, ",") != "package override,service override,temporary level" {
+		t.Fatalf("unexpected logs %v", messages)
+	}
+	select {
+	case fields := <-received:
+		t.Fatalf("unexpected log %q", fields.Export().Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the most specific override wins no matter the order of the overrides
+	levels.SetOverride("database", LevelError, 0)
+	levels.SetOverride("infrastructure/database", LevelDebug, 0)
+	levels.SetOverride("infrastructure", LevelWarn, 0)
+	for i := 0; i < 100; i++ {
+		if !levels.Enabled(LevelDebug, "", "github.com/alioth-center/infrastructure/database/implement.go:120") ||
+			!levels.Enabled(LevelInfo, "", "github.com/alioth-center/infrastructure/database/drift/command.go:30") ||
+			levels.Enabled(LevelInfo, "", "github.com/alioth-center/infrastructure/logger/custom.go:40") {
+			t.Fatalf("unexpected override matching, overrides %v", levels.Overrides())
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); !errors.Is(err, ErrInvalidLevel) {
+		t.Fatalf("expected invalid level, got %v", err)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	type credential struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		IDCard   string `json:"id_card" log:"redact"`
+		Ignored  string `json:"-"`
+		Empty    string `json:"empty,omitempty"`
+	}
+
+	redactor := NewRedactor()
+	entry := NewFields().WithMessage("user alice@example.com logged in from 13812345678").
+		WithData(map[string]any{
+			"headers": map[string][]string{"Authorization": {"Bearer abcdef"}, "Accept": {"application/json"}},
+			"user":    &credential{Username: "alice", Password: "p@ss", IDCard: "110101199001011234", Ignored: "x"},
+			"card":    "4111 1111 1111 1111",
+			"created": "1700000000000",
+		}).
+		WithField("X-Api-Key", "key-123")
+	exported := redactor.Redact(entry).Export()
+
+	if exported.Message != "user ali**********.com logged in from 138****5678" {
+		t.Fatalf("unexpected message: %s", exported.Message)
+	}
+	data := exported.Data.(map[string]any)
+	headers := data["headers"].(map[string]any)
+	user := data["user"].(map[string]any)
+	if fmt.Sprint(headers["Authorization"]) != "[*************]" || fmt.Sprint(headers["Accept"]) != "[application/json]" {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+	if user["username"] != "alice" || user["password"] != "****" || user["id_card"] != "******************" || len(user) != 3 {
+		t.Fatalf("unexpected user: %v", user)
+	}
+	if data["card"] != "411************1111" || data["created"] != "1700000000000" {
+		t.Fatalf("unexpected card or timestamp: %v, %v", data["card"], data["created"])
+	}
+	if exported.Extra["X-Api-Key"] != "*******" {
+		t.Fatalf("unexpected extra: %v", exported.Extra)
+	}
+
+	original := entry.Export()
+	if original.Message != "user alice@example.com logged in from 13812345678" || original.Extra["X-Api-Key"] != "key-123" {
+		t.Fatalf("expected the fields of the caller to be kept, got %s, %v", original.Message, original.Extra)
+	}
+}
+
+func TestRedactorEnv(t *testing.T) {
+	enabled := redactEnv
+	redactEnv = true
+	defer func() { redactEnv = enabled }()
+
+	received := make(chan Fields, 1)
+	logger := NewCustomLoggerWithOpts(
+		WithCustomWriterOpts(NewMultiWriter()),
+		WithRedactorOpts(NewRedactor(WithRedactKeysOpts("order_no"))),
+		WithHookOpts(func(fields Fields) { received <- fields }, LevelInfo),
+	)
+	logger.Info(NewFields().WithMessage("order paid").WithField("order_no", "A1234"))
+
+	select {
+	case fields := <-received:
+		if extra := fields.Export().Extra; extra["order_no"] != "*****" {
+			t.Fatalf("expected the redactor of the options to be applied, got %v", extra)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the log to be received")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	received := make(chan *Entry, 64)
+	logger := NewCustomLoggerWithOpts(
+		WithCustomWriterOpts(NewMultiWriter()),
+		WithSamplingOpts(SamplingConfig{
+			Interval: 100 * time.Millisecond,
+			Budget:   SamplingBudget{First: 2, Thereafter: 3},
+			Levels:   map[Level]SamplingBudget{LevelError: {First: 5}},
+		}),
+		WithHookOpts(func(fields Fields) { received <- fields.Export() }, LevelWarn, LevelError),
+	)
+
+	for i := 0; i < 10; i++ {
+		logger.Warn(NewFields().WithMessage("dependency timeout"))
+		logger.Error(NewFields().WithMessage("dependency down"))
+	}
+	logger.Warn(NewFields().WithMessage("another message"))
+
+	counts := map[string]int{}
+	summaries := map[string]string{}
+	deadline := time.After(time.Second)
+	for len(summaries) < 2 {
+		select {
+		case entry := <-received:
+			if sampled, ok := entry.Extra["sampled_message"].(string); ok {
+				summaries[sampled] = entry.Level + ": " + entry.Message
+			} else {
+				counts[entry.Message]++
+			}
+		case <-deadline:
+			t.Fatalf("expected the summaries, got %v, %v", counts, summaries)
+		}
+	}
+
+	if counts["dependency timeout"] != 4 || counts["dependency down"] != 5 || counts["another message"] != 1 {
+		t.Fatalf("unexpected sampled counts: %v", counts)
+	}
+	if summaries["dependency timeout"] != "warn: suppressed 6 similar entries" || summaries["dependency down"] != "error: suppressed 5 similar entries" {
+		t.Fatalf("unexpected summaries: %v", summaries)
+	}
+}
+
+type batchWriter struct {
+	mu      sync.Mutex
+	batches []string
+	closed  bool
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func (b *batchWriter) Write(data []byte) {
+	if b.gate != nil {
+		select {
+		case b.started <- struct{}{}:
+		default:
+		}
+		<-b.gate
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, string(data))
+}
+
+func (b *batchWriter) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+}
+
+func (b *batchWriter) written() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Join(b.batches, "|")
+}
+
+func TestAsyncWriter(t *testing.T) {
+	inner := &batchWriter{}
+	writer := NewAsyncWriter(inner, AsyncConfig{BatchCount: 3, FlushInterval: time.Hour})
+	for _, entry := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		writer.Write([]byte(entry))
+	}
+	writer.Flush()
+	if written := inner.written(); written != "abc|def|g" {
+		t.Fatalf("unexpected batches %q", written)
+	}
+
+	inner = &batchWriter{}
+	writer = NewAsyncWriter(inner, AsyncConfig{FlushInterval: 10 * time.Millisecond})
+	writer.Write([]byte("a"))
+	time.Sleep(100 * time.Millisecond)
+	if written := inner.written(); written != "a" {
+		t.Fatalf("expected the interval to flush the batch, got %q", written)
+	}
+	writer.Write([]byte("b"))
+	writer.Close()
+	writer.Write([]byte("c"))
+	if written := inner.written(); written != "a|b" || !inner.closed {
+		t.Fatalf("expected close to flush the batch and close the writer, got %q", written)
+	}
+
+	for policy, expected := range map[OverflowPolicy]string{OverflowDropNewest: "1|2|3", OverflowDropOldest: "1|3|4"} {
+		inner = &batchWriter{started: make(chan struct{}), gate: make(chan struct{})}
+		writer = NewAsyncWriter(inner, AsyncConfig{BufferSize: 2, BatchCount: 1, Overflow: policy})
+
+		// the first entry blocks the wrapped writer, so the others stay in the buffer
+		writer.Write([]byte("1"))
+		<-inner.started
+		for _, entry := range []string{"2", "3", "4"} {
+			writer.Write([]byte(entry))
+		}
+		close(inner.gate)
+		writer.Close()
+
+		if written := inner.written(); written != expected || writer.Dropped() != 1 {
+			t.Fatalf("unexpected entries of policy %d: %q, dropped %d", policy, written, writer.Dropped())
+		}
+	}
+	path := filepath.Join(t.TempDir(), "async.log")
+	fileWriter := NewAsyncFileWriter(path, AsyncConfig{})
+	fileWriter.Write([]byte("hello\n"))
+	fileWriter.Write([]byte("world\n"))
+	fileWriter.Close()
+	if content, err := os.ReadFile(path); err != nil || string(content) != "hello\nworld\n" {
+		t.Fatalf("unexpected file content %q, %v", content, err)
+	}
+}
@@ -0,0 +1,90 @@
+package hm
+
+import (
+	"time"
+
+	"github.com/alioth-center/infrastructure/logger"
+	"github.com/alioth-center/infrastructure/network/http"
+)
+
+// LogLevelRequest changes the level of the logger, the override of the service or the package is changed if
+// the name is set. The change is reverted after revert_after such as "10m" if set.
+type LogLevelRequest struct {
+	Level       string `json:"level,omitempty"`
+	Name        string `json:"name,omitempty"`
+	RevertAfter string `json:"revert_after,omitempty"`
+	Remove      bool   `json:"remove,omitempty"`
+}
+
+type LogLevelResponse struct {
+	Level        string            `json:"level"`
+	Overrides    map[string]string `json:"overrides,omitempty"`
+	ErrorMessage string            `json:"error_message,omitempty"`
+}
+
+// LogLevelEndPoint creates the endpoint reading the levels with GET and changing them with PUT, it should be
+// registered on the internal or the authenticated routers only.
+//
+// example:
+//
+//	engine.AddEndPoints(hm.LogLevelEndPoint("/debug/log-level", logger.DefaultAtomicLevel()))
+//
+//	// curl -X PUT -d '{"level":"debug","revert_after":"10m"}' http://localhost:8080/debug/log-level
+//	// curl -X PUT -d '{"name":"database","level":"debug"}' http://localhost:8080/debug/log-level
+//	// curl -X PUT -d '{"name":"database","remove":true}' http://localhost:8080/debug/log-level
+func LogLevelEndPoint(router string, levels *logger.AtomicLevel) http.EndPointInterface {
+	return http.NewEndPointBuilder[LogLevelRequest, LogLevelResponse]().
+		SetRouter(http.NewRouter(router)).
+		SetAllowMethods(http.GET, http.PUT).
+		SetHandlerChain(http.NewChain(LogLevelHandler(levels))).
+		Build()
+}
+
+// LogLevelHandler handles the requests of LogLevelEndPoint.
+func LogLevelHandler(levels *logger.AtomicLevel) http.Handler[LogLevelRequest, LogLevelResponse] {
+	return func(ctx http.Context[LogLevelRequest, LogLevelResponse]) {
+		if ctx.RawRequest().Method == string(http.PUT) {
+			if err := changeLogLevel(levels, ctx.Request()); err != nil {
+				ctx.SetStatusCode(http.StatusBadRequest)
+				ctx.SetResponse(LogLevelResponse{Level: string(levels.Level()), ErrorMessage: err.Error()})
+				return
+			}
+		}
+
+		response := LogLevelResponse{Level: string(levels.Level()), Overrides: map[string]string{}}
+		for name, level := range levels.Overrides() {
+			response.Overrides[name] = string(level)
+		}
+		ctx.SetStatusCode(http.StatusOK)
+		ctx.SetResponse(response)
+	}
+}
+
+func changeLogLevel(levels *logger.AtomicLevel, request LogLevelRequest) error {
+	if request.Remove && request.Name != "" {
+		levels.RemoveOverride(request.Name)
+		return nil
+	}
+
+	level, parseErr := logger.ParseLevel(request.Level)
+	if parseErr != nil {
+		return parseErr
+	}
+
+	var revertAfter time.Duration
+	if request.RevertAfter != "" {
+		duration, durationErr := time.ParseDuration(request.RevertAfter)
+		if durationErr != nil {
+			return durationErr
+		}
+		revertAfter = duration
+	}
+
+	if request.Name != "" {
+		levels.SetOverride(request.Name, level, revertAfter)
+	} else {
+		levels.SetLevel(level, revertAfter)
+	}
+
+	return nil
+}
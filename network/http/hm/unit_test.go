@@ -52,3 +52,42 @@ func TestLoggingMiddlewares(t *testing.T) {
 	t.Log(response.BindJson(&receiver))
 	t.Log(receiver)
 }
+
+func TestLogLevelEndPoint(t *testing.T) {
+	levels := logger.NewAtomicLevel(logger.LevelInfo)
+	engine := http.NewEngine("/internal")
+	engine.AddEndPoints(LogLevelEndPoint("/log-level", levels))
+	engine.ServeAsync("0.0.0.0:8002", make(chan struct{}))
+	time.Sleep(time.Millisecond * 100)
+
+	client := http.NewSimpleClient()
+	put := func(request LogLevelRequest) (int, LogLevelResponse) {
+		response, executeErr := client.ExecuteRequest(http.NewRequestBuilder().
+			WithPath("http://localhost:8002/internal/log-level").
+			WithMethod(http.PUT).
+			WithJsonBody(request))
+		if executeErr != nil {
+			t.Fatal(executeErr)
+		}
+
+		receiver := LogLevelResponse{}
+		if bindErr := response.BindJson(&receiver); bindErr != nil {
+			t.Fatal(bindErr)
+		}
+		status, _ := response.Status()
+		return status, receiver
+	}
+
+	if status, response := put(LogLevelRequest{Level: "debug", RevertAfter: "10m"}); status != http.StatusOK || response.Level != "debug" || levels.Level() != logger.LevelDebug {
+		t.Fatalf("unexpected response %d, %+v", status, response)
+	}
+	if status, response := put(LogLevelRequest{Name: "database", Level: "warn"}); status != http.StatusOK || response.Overrides["database"] != "warn" {
+		t.Fatalf("unexpected response %d, %+v", status, response)
+	}
+	if status, response := put(LogLevelRequest{Level: "verbose"}); status != http.StatusBadRequest || response.ErrorMessage == "" {
+		t.Fatalf("expected the invalid level to be rejected, got %d, %+v", status, response)
+	}
+	if status, response := put(LogLevelRequest{Name: "database", Remove: true}); status != http.StatusOK || len(response.Overrides) != 0 {
+		t.Fatalf("unexpected response %d, %+v", status, response)
+	}
+}
@@ -3,9 +3,12 @@ package encrypt
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 )
 
@@ -65,6 +68,71 @@ func AesDecrypt(encrypted string, secret string) (decrypted string, err error) {
 	return string(encryptedBytes), nil
 }
 
+// AesGcmEncrypt 使用 AES-GCM 加密算法加密消息，密文带有认证标签，被篡改时无法解密
+//   - message: 明文消息
+//   - secret: 密钥，长度必须是 16、24 或 32 位
+//   - encrypted: 加密后的消息，为 base64 编码的随机 nonce 与密文
+//   - err: 错误信息
+func AesGcmEncrypt(message string, secret string) (encrypted string, err error) {
+	block, buildAesBlockErr := aes.NewCipher([]byte(secret))
+	if buildAesBlockErr != nil {
+		return "", buildAesBlockErr
+	}
+
+	gcm, buildGcmErr := cipher.NewGCM(block)
+	if buildGcmErr != nil {
+		return "", buildGcmErr
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, buildNonceErr := rand.Read(nonce); buildNonceErr != nil {
+		return "", buildNonceErr
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(message), nil)), nil
+}
+
+// AesGcmDecrypt 使用 AES-GCM 加密算法解密消息
+//   - encrypted: AesGcmEncrypt 加密后的消息
+//   - secret: 密钥，长度必须是 16、24 或 32 位
+//   - decrypted: 解密后的消息
+//   - err: 错误信息，密钥错误或密文被篡改时返回错误
+func AesGcmDecrypt(encrypted string, secret string) (decrypted string, err error) {
+	block, buildAesBlockErr := aes.NewCipher([]byte(secret))
+	if buildAesBlockErr != nil {
+		return "", buildAesBlockErr
+	}
+
+	gcm, buildGcmErr := cipher.NewGCM(block)
+	if buildGcmErr != nil {
+		return "", buildGcmErr
+	}
+
+	encryptedBytes, decodeErr := base64.StdEncoding.DecodeString(encrypted)
+	if decodeErr != nil {
+		return "", decodeErr
+	}
+
+	if len(encryptedBytes) < gcm.NonceSize()+gcm.Overhead() {
+		return "", fmt.Errorf("encrypted message too short")
+	}
+
+	nonce, cipherText := encryptedBytes[:gcm.NonceSize()], encryptedBytes[gcm.NonceSize():]
+	plainText, openErr := gcm.Open(nil, nonce, cipherText, nil)
+	if openErr != nil {
+		return "", openErr
+	}
+
+	return string(plainText), nil
+}
+
+// HmacSHA256 使用 HMAC-SHA256 算法计算消息的摘要，结果为十六进制字符串，相同的消息与密钥得到相同的摘要
+func HmacSHA256(message string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 // HashMD5 使用 MD5 算法计算消息的哈希值
 func HashMD5(message string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(message)))
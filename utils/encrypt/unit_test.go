@@ -26,6 +26,27 @@ func TestEncoding(t *testing.T) {
 	t.Log("encrypted message:", encrypted, "decrypted message:", decrypted)
 }
 
+func TestAesGcm(t *testing.T) {
+	secret := "12345678901234567890123456789012"
+	encrypted, ee := AesGcmEncrypt("i love u", secret)
+	if ee != nil {
+		t.Fatal(ee)
+	}
+
+	decrypted, de := AesGcmDecrypt(encrypted, secret)
+	if de != nil || decrypted != "i love u" {
+		t.Fatalf("decrypted message not match: %s, %v", decrypted, de)
+	}
+
+	if _, de = AesGcmDecrypt(encrypted, "12345678901234567890123456789000"); de == nil {
+		t.Error("expected decrypt with wrong secret to fail")
+	}
+
+	if HmacSHA256("i love u", secret) != HmacSHA256("i love u", secret) || HmacSHA256("i love u", secret) == HmacSHA256("i love you", secret) {
+		t.Error("hmac result not match")
+	}
+}
+
 func TestPasswd(t *testing.T) {
 	encoded, ee := BcryptEncode("i love u")
 	if ee != nil {